@@ -0,0 +1,137 @@
+package ftp
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dirCache caches directory listings, and the replies to SIZE and MDTM, by server path,
+// evicting the least recently used ones beyond max.
+type dirCache struct {
+	ttl time.Duration
+	max int
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[cacheKey]*list.Element
+}
+
+// cacheKey names a cached reply, to LIST for a listing, whether it is listed with LIST or MLSD, SIZE or MDTM.
+type cacheKey struct {
+	cmd  string
+	path string
+}
+
+// cachedCmds are the commands of cacheKey.
+var cachedCmds = []string{"LIST", "SIZE", "MDTM"}
+
+type dirCacheItem struct {
+	key     cacheKey
+	value   any
+	expires time.Time
+}
+
+func newDirCache(ttl time.Duration, max int) *dirCache {
+	return &dirCache{ttl: ttl, max: max, lru: list.New(), items: make(map[cacheKey]*list.Element)}
+}
+
+// get returns a copy of the listing of dir, if it is cached and fresh.
+func (c *dirCache) get(dir string) ([]*listEntry, bool) {
+	v, ok := c.getValue(cacheKey{cmd: "LIST", path: dir})
+	if !ok {
+		return nil, false
+	}
+	return append([]*listEntry(nil), v.([]*listEntry)...), true
+}
+
+// put caches a copy of the listing of dir.
+func (c *dirCache) put(dir string, entries []*listEntry) {
+	c.putValue(cacheKey{cmd: "LIST", path: dir}, append([]*listEntry(nil), entries...))
+}
+
+// getSize returns the size of the file at p, if it is cached and fresh.
+func (c *dirCache) getSize(p string) (int64, bool) {
+	v, ok := c.getValue(cacheKey{cmd: "SIZE", path: p})
+	if !ok {
+		return 0, false
+	}
+	return v.(int64), true
+}
+
+func (c *dirCache) putSize(p string, size int64) {
+	c.putValue(cacheKey{cmd: "SIZE", path: p}, size)
+}
+
+// getTime returns the modification time of the file at p, if it is cached and fresh.
+func (c *dirCache) getTime(p string) (time.Time, bool) {
+	v, ok := c.getValue(cacheKey{cmd: "MDTM", path: p})
+	if !ok {
+		return time.Time{}, false
+	}
+	return v.(time.Time), true
+}
+
+func (c *dirCache) putTime(p string, t time.Time) {
+	c.putValue(cacheKey{cmd: "MDTM", path: p}, t)
+}
+
+func (c *dirCache) getValue(key cacheKey) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := el.Value.(*dirCacheItem)
+	if time.Now().After(item.expires) {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return item.value, true
+}
+
+func (c *dirCache) putValue(key cacheKey, value any) {
+	item := &dirCacheItem{key: key, value: value, expires: time.Now().Add(c.ttl)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value = item
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(item)
+	for c.max > 0 && c.lru.Len() > c.max {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.items, el.Value.(*dirCacheItem).key)
+	}
+}
+
+// invalidate drops the listing of p, and its size and modification time.
+func (c *dirCache) invalidate(p string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cmd := range cachedCmds {
+		key := cacheKey{cmd: cmd, path: p}
+		if el, ok := c.items[key]; ok {
+			c.lru.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
+
+// invalidateTree drops what is cached of dir and of the paths under it.
+func (c *dirCache) invalidateTree(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		if key.path == dir || strings.HasPrefix(key.path, dir+"/") {
+			c.lru.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
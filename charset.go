@@ -0,0 +1,77 @@
+package ftp
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset converts names between UTF-8, which names of a FS are in, and the charset of the server.
+type Charset interface {
+	// Encode converts name to the charset of the server.
+	Encode(name string) string
+	// Decode converts name from the charset of the server.
+	Decode(name string) string
+}
+
+// Latin1 is the ISO 8859-1 charset, whose bytes are the first 256 code points of Unicode.
+// Characters beyond them are encoded as '?'.
+var Latin1 Charset = latin1{}
+
+type latin1 struct{}
+
+func (latin1) Encode(name string) string {
+	b := make([]byte, 0, len(name))
+	for _, r := range name {
+		if r > 0xff {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+func (latin1) Decode(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	for i := 0; i < len(name); i++ {
+		if name[i] < utf8.RuneSelf {
+			b.WriteByte(name[i])
+		} else {
+			b.WriteRune(rune(name[i]))
+		}
+	}
+	return b.String()
+}
+
+// WithCharset sets the charset of the names that the server sends and expects, such as Latin1,
+// for servers that do not speak UTF-8.
+// jlaffaye/ftp switches servers that advertise UTF8 in FEAT to UTF-8 with OPTS UTF8 ON,
+// and on connections opened by Dial to such servers, the charset is ignored.
+// Names are in UTF-8 by default.
+func WithCharset(cs Charset) Option {
+	return func(o *options) {
+		o.charset = cs
+	}
+}
+
+// encode converts the server path p to the charset of the server.
+func (fsys *FS) encode(p string) string {
+	if fsys.opts.charset == nil {
+		return p
+	}
+	return fsys.opts.charset.Encode(p)
+}
+
+// decode converts p from the charset of the server.
+func (fsys *FS) decode(p string) string {
+	if fsys.opts.charset == nil {
+		return p
+	}
+	return fsys.opts.charset.Decode(p)
+}
+
+// listed converts e as listed by the server to the names of fsys, see baseName.
+func (fsys *FS) listed(e *listEntry) {
+	e.Name = fsys.decode(baseName(e.Name))
+	e.Target = fsys.decode(e.Target)
+}
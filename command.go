@@ -0,0 +1,37 @@
+package ftp
+
+import (
+	"io/fs"
+	"strings"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// Command sends cmd, such as "SITE QUOTA", on the control connection of one of the connections of the FS,
+// and returns the code and message of the reply, whatever the code, so that err is only set if no reply is read.
+// It is an escape hatch for commands that the FS does not model, and is not retried, see WithRetry.
+// Commands that open a data connection, such as RETR or LIST, or that change the state of the connection,
+// such as CWD, TYPE or REIN, must not be sent, as they leave the connection out of sync with the FS.
+// It fails with ErrUnsupported if fsys was not opened by Dial.
+func (fsys *FS) Command(cmd string) (code int, msg string, err error) {
+	if strings.ContainsAny(cmd, "\r\n") {
+		return 0, "", &fs.PathError{Op: "command", Path: cmd, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return 0, "", &fs.PathError{Op: "command", Path: cmd, Err: ErrReadOnly}
+	}
+	c, err := fsys.acquire()
+	if err != nil {
+		return 0, "", err
+	}
+	err = fsys.run(c, func(c *jlaftp.ServerConn) (err error) {
+		code, msg, err = fsys.command(c, 0, "%s", cmd)
+		return err
+	})
+	fsys.release(c, err)
+	if err != nil {
+		return 0, "", errors.WithStack(mapErr(err))
+	}
+	return code, msg, nil
+}
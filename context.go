@@ -0,0 +1,121 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// expired is a deadline in the past, which interrupts blocked reads and writes.
+var expired = time.Unix(1, 0)
+
+// WithContext returns a FS that shares the connections and cache of fsys,
+// whose operations fail once ctx is done. Files opened from it keep ctx for their reads.
+// Commands in progress are interrupted only on connections opened by Dial,
+// which are then replaced. Otherwise, ctx is checked before each command,
+// and transfers are interrupted through their data connections.
+func (fsys *FS) WithContext(ctx context.Context) *FS {
+	v := *fsys
+	v.ctx = ctx
+	return &v
+}
+
+// OpenContext opens a file as Open, see WithContext.
+func (fsys *FS) OpenContext(ctx context.Context, name string) (fs.File, error) {
+	return fsys.WithContext(ctx).Open(name)
+}
+
+// StatContext returns the information of a file as Stat, see WithContext.
+func (fsys *FS) StatContext(ctx context.Context, name string) (fs.FileInfo, error) {
+	return fsys.WithContext(ctx).Stat(name)
+}
+
+// ReadDirContext reads a directory as ReadDir, see WithContext.
+func (fsys *FS) ReadDirContext(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	return fsys.WithContext(ctx).ReadDir(name)
+}
+
+// run runs op on c, interrupting it when the context of fsys is done.
+func (fsys *FS) run(c *jlaftp.ServerConn, op func(*jlaftp.ServerConn) error) error {
+	if fsys.ctx.Done() == nil {
+		return op(c)
+	}
+	if err := fsys.ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	if t := fsys.conns.transport(c); t != nil {
+		defer fsys.watch(t)()
+	}
+	return fsys.interrupted(op(c))
+}
+
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// watch applies the deadline of the context of fsys to d,
+// and expires it early when the context is done, until the returned stop is called.
+func (fsys *FS) watch(d deadliner) (stop func()) {
+	return watch(fsys.ctx, d)
+}
+
+// watch applies the deadline of ctx to d, as FS.watch.
+func watch(ctx context.Context, d deadliner) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			d.SetDeadline(expired)
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+		d.SetDeadline(time.Time{})
+	}
+}
+
+// interrupted returns err as caused by the context of fsys, if it is done.
+func (fsys *FS) interrupted(err error) error {
+	return interrupted(fsys.ctx, err)
+}
+
+// interrupted returns err as caused by ctx, if it is done.
+func interrupted(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	return &interruptedError{err: err, ctxErr: ctx.Err()}
+}
+
+// interruptedError is an error of an operation interrupted by its context.
+// It unwraps to the error of the operation, but also matches the context error with errors.Is.
+type interruptedError struct {
+	err    error
+	ctxErr error
+}
+
+func (e *interruptedError) Error() string {
+	return fmt.Sprintf("%v: %v", e.ctxErr, e.err)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return e.err
+}
+
+func (e *interruptedError) Is(target error) bool {
+	return target == e.ctxErr
+}
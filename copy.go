@@ -0,0 +1,84 @@
+package ftp
+
+import (
+	"io"
+	"io/fs"
+	"os"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// CopyFile copies the file src to dst.
+// The copy is made on the server with SITE CPFR and CPTO, as in the mod_copy module of ProFTPD, if available.
+// Otherwise, src is downloaded and uploaded to dst, which is removed if the copy fails.
+// Without a second connection to upload on, as with NewFS or Dial, src is first downloaded to a temporary file.
+func (fsys *FS) CopyFile(dst, src string) error {
+	if !fs.ValidPath(src) || !fs.ValidPath(dst) {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: ErrReadOnly}
+	}
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		if _, _, err := fsys.command(c, jlaftp.StatusRequestFilePending, "SITE CPFR %s", fsys.serverPath(src)); err != nil {
+			return err
+		}
+		_, _, err := fsys.command(c, jlaftp.StatusRequestedFileActionOK, "SITE CPTO %s", fsys.serverPath(dst))
+		return err
+	})
+	if err == nil {
+		fsys.Invalidate(dst)
+		return nil
+	}
+	if err = mapErr(err); errors.Is(err, ErrUnsupported) {
+		err = fsys.streamCopy(dst, src)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "copy", Old: src, New: dst, Err: errors.WithStack(err)}
+	}
+	return nil
+}
+
+// streamCopy copies src to dst through the client.
+func (fsys *FS) streamCopy(dst, src string) error {
+	rf, err := fsys.open(src, false)
+	if err != nil {
+		return err
+	}
+	defer rf.Close()
+	if rf.info.IsDir() {
+		return errors.New("is a directory")
+	}
+	var r io.Reader = rf
+	if cap(fsys.conns.sem) < 2 {
+		tmp, err := os.CreateTemp("", "ftp-copy-*")
+		if err != nil {
+			return errors.Wrap(err, "")
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		// Reading to the end returns the connection for the upload.
+		if _, err := io.Copy(tmp, rf); err != nil {
+			return err
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "")
+		}
+		r = tmp
+	}
+
+	w, err := fsys.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fsys.Remove(dst)
+		return err
+	}
+	return nil
+}
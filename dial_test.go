@@ -0,0 +1,253 @@
+package ftp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fumin/ftp"
+	"github.com/fumin/ftp/ftptest"
+)
+
+// forward accepts connections on l, and forwards them to addr.
+func forward(l net.Listener, addr string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
+
+func TestDialerDataHost(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{"dir/file.txt": {Data: []byte("hello")}})
+	// The proxy is on another host than the server, so that data connections to its host fail.
+	proxy, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("no second loopback address: %v", err)
+	}
+	defer proxy.Close()
+	go forward(proxy, srv.Addr)
+
+	var mu sync.Mutex
+	var dialed []string
+	dialer := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialed = append(dialed, addr)
+		first := len(dialed) == 1
+		mu.Unlock()
+		var d net.Dialer
+		if first {
+			return d.DialContext(ctx, network, proxy.Addr().String())
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+	for _, mlsd := range []bool{true, false} {
+		mu.Lock()
+		dialed = nil
+		mu.Unlock()
+		// Without MLSD, listings and retrievals are by jlaffaye/ftp.
+		fsys := dial(t, srv, ftp.WithDialer(dialer), ftp.WithMLSD(mlsd))
+		if _, err := fsys.ReadDir("dir"); err != nil {
+			t.Fatalf("MLSD %v: %v", mlsd, err)
+		}
+		b, err := fsys.ReadFile("dir/file.txt")
+		if err != nil || string(b) != "hello" {
+			t.Fatalf("MLSD %v: ReadFile = %q, %v", mlsd, b, err)
+		}
+		mu.Lock()
+		for _, addr := range dialed[1:] {
+			if host, _, _ := net.SplitHostPort(addr); host != "127.0.0.1" {
+				t.Errorf("MLSD %v: data connection to %s", mlsd, addr)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+// commandLog is a WithDialer that records the commands sent on the control connection.
+type commandLog struct {
+	mu     sync.Mutex
+	dialed bool
+	cmds   []string
+}
+
+func (l *commandLog) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.dialed {
+		// A data connection.
+		return conn, nil
+	}
+	l.dialed = true
+	return loggedConn{Conn: conn, log: l}, nil
+}
+
+// count returns how many times cmd has been sent.
+func (l *commandLog) count(cmd string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, c := range l.cmds {
+		if c == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+type loggedConn struct {
+	net.Conn
+	log *commandLog
+}
+
+func (c loggedConn) Write(b []byte) (int, error) {
+	c.log.mu.Lock()
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			c.log.cmds = append(c.log.cmds, strings.ToUpper(fields[0]))
+		}
+	}
+	c.log.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestEPSV(t *testing.T) {
+	files := fstest.MapFS{"dir/file.txt": {Data: []byte("hello")}}
+	for _, test := range []struct {
+		server, client bool
+		// pasv is whether PASV is sent, instead of or after EPSV.
+		pasv bool
+	}{
+		{server: true, client: true, pasv: false},
+		{server: true, client: false, pasv: true},
+		{server: false, client: true, pasv: true},
+		{server: false, client: false, pasv: true},
+	} {
+		srv := newServer(t, files, ftptest.WithEPSV(test.server))
+		for _, mlsd := range []bool{true, false} {
+			// Without MLSD, listings are by jlaffaye/ftp.
+			var cmds commandLog
+			fsys := dial(t, srv, ftp.WithEPSV(test.client), ftp.WithMLSD(mlsd), ftp.WithDialer(cmds.dial))
+			if _, err := fsys.ReadDir("dir"); err != nil {
+				t.Fatalf("server EPSV %v, WithEPSV(%v), MLSD %v: %v", test.server, test.client, mlsd, err)
+			}
+			b, err := fsys.ReadFile("dir/file.txt")
+			if err != nil || string(b) != "hello" {
+				t.Fatalf("server EPSV %v, WithEPSV(%v), MLSD %v: ReadFile = %q, %v", test.server, test.client, mlsd, b, err)
+			}
+			if epsv := cmds.count("EPSV"); (epsv > 0) != test.client {
+				t.Errorf("server EPSV %v, WithEPSV(%v), MLSD %v: EPSV sent %d times", test.server, test.client, mlsd, epsv)
+			}
+			if pasv := cmds.count("PASV"); (pasv > 0) != test.pasv {
+				t.Errorf("server EPSV %v, WithEPSV(%v), MLSD %v: PASV sent %d times", test.server, test.client, mlsd, pasv)
+			}
+		}
+	}
+}
+
+func ExampleWithEPSV() {
+	// The server only accepts PASV, as behind some firewalls.
+	// Servers over IPv6, such as at "[2001:db8::1]:21", need EPSV instead, which is the default.
+	srv, err := ftptest.NewServer(fstest.MapFS{"hello.txt": {Data: []byte("hello, world\n")}}, ftptest.WithEPSV(false))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srv.Close()
+	fsys, err := ftp.Dial(context.Background(), srv.Addr, ftp.WithEPSV(false))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fsys.Close()
+
+	b, err := fs.ReadFile(fsys, "hello.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(b))
+	// Output: hello, world
+}
+
+func TestDialCancel(t *testing.T) {
+	// The server hangs in the login, which only the context can interrupt, before the command timeout.
+	srv := newServer(t, fstest.MapFS{}, ftptest.WithStall("PASS"))
+	for _, test := range []struct {
+		desc string
+		// option returns an Option of Dial, and arranges for cancel to cancel its context.
+		option func(cancel context.CancelFunc) ftp.Option
+	}{
+		{"cancelled in the login", func(cancel context.CancelFunc) ftp.Option {
+			time.AfterFunc(100*time.Millisecond, cancel)
+			return ftp.WithCommandTimeout(time.Minute)
+		}},
+		// A cancellation between the replies that the login reads holds for those that follow.
+		{"cancelled after the greeting", func(cancel context.CancelFunc) ftp.Option {
+			return ftp.WithDialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				var d net.Dialer
+				conn, err := d.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &cancelConn{Conn: conn, cancel: cancel}, nil
+			})
+		}},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		start := time.Now()
+		fsys, err := ftp.Dial(ctx, srv.Addr, ftp.WithCommandTimeout(time.Minute), test.option(cancel))
+		cancel()
+		if err == nil {
+			fsys.Close()
+		}
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: Dial = %v, want %v", test.desc, err, context.Canceled)
+		}
+		if d := time.Since(start); d > 5*time.Second {
+			t.Errorf("%s: Dial returned after %v", test.desc, d)
+		}
+	}
+}
+
+// cancelConn cancels a context once it has read a reply, such as the greeting.
+type cancelConn struct {
+	net.Conn
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (c *cancelConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if bytes.Contains(b[:n], []byte("\r\n")) {
+		c.once.Do(func() {
+			c.cancel()
+			// Let the cancellation reach the connection before the login goes on.
+			time.Sleep(50 * time.Millisecond)
+		})
+	}
+	return n, err
+}
@@ -0,0 +1,244 @@
+package ftp
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// DownloadTo writes the named file to w with RETR, and returns the number of bytes written.
+// Unlike copying from Open, the transfer is read to its end before the connection is returned,
+// so that nothing is left for Close to drain.
+// If writing to w fails, the rest of the transfer is drained or aborted as in Close, see WithDrain.
+func (fsys *FS) DownloadTo(name string, w io.Writer) (int64, error) {
+	return fsys.DownloadFrom(name, w, 0)
+}
+
+// DownloadFrom writes the named file from offset on to w, as DownloadTo,
+// restarting the transfer at offset with REST, as in a resumed download, see ResumeFile.
+// Offsets are those of binary mode, which is why resuming is unreliable in ASCII mode.
+func (fsys *FS) DownloadFrom(name string, w io.Writer, offset int64) (n int64, err error) {
+	defer fsys.observe("download", name, time.Now(), &err)
+	if !fs.ValidPath(name) {
+		return 0, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "open", Path: name, Err: errors.Errorf("negative offset %d", offset)}
+	}
+	var resp *jlaftp.Response
+	c, err := fsys.hold(func(c *jlaftp.ServerConn) (err error) {
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.RetrFrom(fsys.serverPath(name), uint64(offset))
+		fsys.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return 0, &fs.PathError{Op: "open", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+
+	stop := fsys.watch(resp)
+	var p progress
+	n, err = io.Copy(progressWriter{w: w, p: &p, fn: fsys.opts.progress, name: name}, fsys.limitReader(resp))
+	fsys.opts.metrics.Transferred("read", n)
+	if ferr := fsys.finish(c, resp, err == nil); ferr != nil && err == nil {
+		err = ferr
+	}
+	stop()
+	p.finish(fsys.opts.progress, name)
+	if err != nil {
+		return n, &fs.PathError{Op: "read", Path: name, Err: errors.WithStack(fsys.interrupted(err))}
+	}
+	return n, nil
+}
+
+// DownloadFile downloads the named file to the local file localPath, as DownloadTo.
+// The file is written to a temporary file next to localPath, which is renamed to localPath once complete,
+// so that a failed download neither leaves a partial file nor clobbers an existing one.
+func (fsys *FS) DownloadFile(name, localPath string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fsys.DownloadTo(name, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "")
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return nil
+}
+
+// ResumeFile downloads the rest of the named file to the local file localPath,
+// starting at the size of localPath, which is created if it does not exist.
+// It returns the number of bytes appended, and can be called again after a failure,
+// as what has been written so far is kept.
+// If the server supports SIZE, localPath is checked against the size of the file,
+// failing with io.ErrUnexpectedEOF if the download ends short,
+// and with an error if localPath is already longer.
+// The file is downloaded in binary mode.
+func (fsys *FS) ResumeFile(name, localPath string) (int64, error) {
+	fsys = fsys.ASCII(false)
+	f, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	offset := info.Size()
+
+	size, err := fsys.FileSize(name)
+	known := err == nil
+	if known && offset > size {
+		return 0, &fs.PathError{Op: "resume", Path: name, Err: errors.Errorf("%s has %d bytes, more than the %d of the file", localPath, offset, size)}
+	}
+	var n int64
+	if !known || offset < size {
+		if n, err = fsys.DownloadFrom(name, f, offset); err != nil {
+			return n, err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return n, errors.Wrap(err, "")
+	}
+	if known && offset+n != size {
+		return n, &fs.PathError{Op: "resume", Path: name, Err: errors.Wrapf(io.ErrUnexpectedEOF, "%d of %d bytes", offset+n, size)}
+	}
+	return n, nil
+}
+
+// DownloadParallel downloads the named file to the local file localPath, as DownloadFile,
+// splitting it into segments that are retrieved concurrently with REST over connections of their own.
+// There are at most as many segments as connections in the pool of fsys, see NewPoolFS.
+// It downloads the file in a single stream, as DownloadFile, if the server does not support SIZE,
+// and retries segments one at a time over the connections that could be opened,
+// if the server refuses some of the connections.
+// Segments are downloaded in binary mode, and the transfers of all but the last one are aborted
+// once the segment is read, which replaces their connections, see WithDrain.
+func (fsys *FS) DownloadParallel(name, localPath string, segments int) error {
+	if segments > cap(fsys.conns.sem) {
+		segments = cap(fsys.conns.sem)
+	}
+	size, err := fsys.FileSize(name)
+	if err != nil || segments <= 1 || size < int64(segments) || fsys.conns.dial == nil {
+		return fsys.DownloadFile(name, localPath)
+	}
+	fsys = fsys.ASCII(false)
+
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".*")
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := tmp.Truncate(size); err != nil {
+		return errors.Wrap(err, "")
+	}
+
+	// segment downloads the i-th segment, the last of which takes the remainder of the division.
+	segment := func(i int) error {
+		n := size / int64(segments)
+		off := int64(i) * n
+		last := i == segments-1
+		if last {
+			n = size - off
+		}
+		return fsys.downloadSegment(name, tmp, off, n, last)
+	}
+	errs := make([]error, segments)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = segment(i)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		fsys.opts.logger.Printf("%+v", errors.Wrapf(err, "segment %d of %s", i, name))
+		// Retried alone, in case the server limits the connections of a client.
+		if err := segment(i); err != nil {
+			return &fs.PathError{Op: "read", Path: name, Err: err}
+		}
+	}
+
+	if err := tmp.Chmod(0644); err != nil {
+		return errors.Wrap(err, "")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "")
+	}
+	if err := os.Rename(tmp.Name(), localPath); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return nil
+}
+
+// downloadSegment writes the n bytes of the named file from off on to the same offsets of f.
+// The transfer is aborted after them, unless the segment is the last of the file.
+func (fsys *FS) downloadSegment(name string, f *os.File, off, n int64, last bool) error {
+	var resp *jlaftp.Response
+	c, err := fsys.hold(func(c *jlaftp.ServerConn) (err error) {
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.RetrFrom(fsys.serverPath(name), uint64(off))
+		fsys.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return errors.WithStack(mapErr(err))
+	}
+
+	stop := fsys.watch(resp)
+	m, err := io.CopyN(&offsetWriter{f: f, off: off}, fsys.limitReader(resp), n)
+	fsys.opts.metrics.Transferred("read", m)
+	// The rest of the file belongs to the following segments, so it is not drained.
+	end := *fsys
+	end.opts.drain = last
+	if ferr := end.finish(c, resp, false); ferr != nil && err == nil {
+		err = ferr
+	}
+	stop()
+	if err != nil {
+		return errors.WithStack(fsys.interrupted(err))
+	}
+	return nil
+}
+
+// offsetWriter writes to f from off on.
+type offsetWriter struct {
+	f   *os.File
+	off int64
+}
+
+func (w *offsetWriter) Write(b []byte) (int, error) {
+	n, err := w.f.WriteAt(b, w.off)
+	w.off += int64(n)
+	return n, err
+}
@@ -0,0 +1,144 @@
+package ftp
+
+import (
+	"io"
+	"io/fs"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"syscall"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// Errors of operations match these with errors.Is, according to the reply of the server.
+var (
+	// ErrNotExist is for a missing file, as reported with 550.
+	ErrNotExist = fs.ErrNotExist
+	// ErrPermission is for a file or a command that the login may not access,
+	// as reported with 530, 532, or 550 with a text such as "Permission denied".
+	ErrPermission = fs.ErrPermission
+	// ErrUnsupported is for an operation that the server does not support, as reported with 500, 502 or 504.
+	ErrUnsupported = errors.New("not supported by the server")
+	// ErrConnClosed is for a lost connection, closed by the server with 421 or otherwise.
+	ErrConnClosed = errors.New("connection closed")
+)
+
+// replyError is a server reply or a lost connection that stands for one of the errors above.
+// It unwraps to the original reply, but also matches kind with errors.Is.
+type replyError struct {
+	err  error
+	kind error
+}
+
+func (e *replyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *replyError) Unwrap() error {
+	return e.err
+}
+
+func (e *replyError) Is(target error) bool {
+	return target == e.kind
+}
+
+// MultiError holds the errors of an operation that failed at several steps,
+// such as File.Close, which may fail to drain the transfer and then to close it, see WithDrain.
+// It matches each of its errors with errors.Is and errors.As.
+type MultiError []error
+
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m MultiError) As(target any) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapErr translates the server reply in err, or the loss of the connection, into the corresponding error above.
+// Other errors are returned as is.
+func mapErr(err error) error {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		if isConnClosed(err) {
+			return &replyError{err: err, kind: ErrConnClosed}
+		}
+		return err
+	}
+	switch reply.Code {
+	case jlaftp.StatusFileUnavailable:
+		return &replyError{err: err, kind: unavailableKind(reply.Msg)}
+	case jlaftp.StatusNotLoggedIn, jlaftp.StatusStorNeedAccount:
+		return &replyError{err: err, kind: ErrPermission}
+	case jlaftp.StatusBadCommand, jlaftp.StatusNotImplemented, jlaftp.StatusNotImplementedParameter:
+		return &replyError{err: err, kind: ErrUnsupported}
+	case jlaftp.StatusNotAvailable:
+		return &replyError{err: err, kind: ErrConnClosed}
+	}
+	return err
+}
+
+// notExistWords are in the text of 550 replies for files that do not exist, such as "No such file or directory",
+// or "Requested action not taken. File unavailable (e.g., file not found, no access)." from RFC 959,
+// which tells both and is therefore looked up before permissionWords.
+var notExistWords = []string{"no such", "not found", "cannot find", "does not exist"}
+
+// permissionWords are in the text of 550 replies for files that exist but may not be accessed,
+// such as "Permission denied" from vsftpd and ProFTPD, or "Access is denied." from IIS.
+var permissionWords = []string{"permission", "denied", "not allowed", "forbidden"}
+
+// unavailableKind returns the error that a 550 reply with msg stands for,
+// which is ErrPermission if msg tells so and not that the file does not exist, and ErrNotExist otherwise.
+func unavailableKind(msg string) error {
+	msg = strings.ToLower(msg)
+	for _, w := range notExistWords {
+		if strings.Contains(msg, w) {
+			return ErrNotExist
+		}
+	}
+	for _, w := range permissionWords {
+		if strings.Contains(msg, w) {
+			return ErrPermission
+		}
+	}
+	return ErrNotExist
+}
+
+// isConnClosed reports whether err shows that the connection to the server is lost.
+// A connection that timed out is lost too, as the rest of a reply may still be in flight.
+func isConnClosed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return reply.Code == jlaftp.StatusNotAvailable
+	}
+	for _, target := range []error{io.EOF, io.ErrUnexpectedEOF, net.ErrClosed, os.ErrDeadlineExceeded, syscall.EPIPE, syscall.ECONNRESET} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package ftp
+
+import "testing"
+
+func TestUnavailableKind(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		want error
+	}{
+		{"No such file or directory", ErrNotExist},
+		{"Requested action not taken. File unavailable (e.g., file not found, no access).", ErrNotExist},
+		{"/a.txt: The system cannot find the file specified.", ErrNotExist},
+		{"Permission denied", ErrPermission},
+		{"Access is denied.", ErrPermission},
+		{"Operation not allowed", ErrPermission},
+		{"Forbidden filename", ErrPermission},
+		{"No access", ErrNotExist},
+		{"Failed to open file.", ErrNotExist},
+	} {
+		if got := unavailableKind(test.msg); got != test.want {
+			t.Errorf("unavailableKind(%q) = %v, want %v", test.msg, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ftp
+
+import (
+	"io/fs"
+	"strings"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// Features returns the features that the server advertises in its reply to FEAT, as in RFC 2389,
+// keyed by their upper case name, such as "MLST" or "MDTM", with their parameters, if any, as values.
+// A server that does not implement FEAT has no features.
+// The reply is read once and shared by the connections of the FS, as features do not change during a session.
+// It fails with ErrUnsupported if fsys was not opened by Dial.
+func (fsys *FS) Features() (map[string]string, error) {
+	feats, err := fsys.features()
+	if err != nil {
+		return nil, &fs.PathError{Op: "feat", Path: ".", Err: err}
+	}
+	m := make(map[string]string, len(feats))
+	for k, v := range feats {
+		m[k] = v
+	}
+	return m, nil
+}
+
+// features returns the cached features of the server, reading them on first use.
+func (fsys *FS) features() (map[string]string, error) {
+	fsys.conns.mu.Lock()
+	feats := fsys.conns.features
+	fsys.conns.mu.Unlock()
+	if feats != nil {
+		return feats, nil
+	}
+
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		code, msg, err := fsys.command(c, 0, "FEAT")
+		if err != nil {
+			return err
+		}
+		feats = parseFeatures(code, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(mapErr(err))
+	}
+	fsys.conns.mu.Lock()
+	fsys.conns.features = feats
+	fsys.conns.mu.Unlock()
+	return feats, nil
+}
+
+// parseFeatures parses a reply to FEAT, whose feature lines start with a space,
+// such as "211-Features:\n MDTM\n MLST type*;size*;\n211 End".
+func parseFeatures(code int, msg string) map[string]string {
+	feats := make(map[string]string)
+	if code != jlaftp.StatusSystem {
+		return feats
+	}
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		name, params, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if name != "" {
+			feats[strings.ToUpper(name)] = params
+		}
+	}
+	return feats
+}
@@ -2,20 +2,39 @@
 package ftp
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"net/textproto"
+	"os"
 	"path"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	jlaftp "github.com/jlaffaye/ftp"
 	"github.com/pkg/errors"
 )
 
+// listEntry is a listed entry, with its permission bits if the listing has them, see fileinfo.Mode.
+type listEntry struct {
+	jlaftp.Entry
+	// perm is set if hasPerm is, by parseMLSD.
+	perm    fs.FileMode
+	hasPerm bool
+	// linked is the name of the target of the symlink that the entry is listed as, see linkedEntry.
+	linked string
+}
+
 type fileinfo struct {
-	e jlaftp.Entry
+	e listEntry
+	// listed is the size in the listing, if sized is set because e has the size from SIZE instead.
+	listed int64
+	sized  bool
 }
 
 func (info fileinfo) Name() string {
@@ -26,17 +45,26 @@ func (info fileinfo) Size() int64 {
 	return int64(info.e.Size)
 }
 
+// Mode returns the type of the file, with the permission bits in the unix.mode fact of its MLSD listing,
+// or else the usual permission bits of its type, 0644 for a file, 0755 for a directory and 0777 for a symlink,
+// narrowed to the rights of the user in the perm fact.
+// Only listings read with MLSD on connections of Dial have facts, as jlaffaye/ftp parses the others.
 func (info fileinfo) Mode() fs.FileMode {
+	var typ, perm fs.FileMode
 	switch info.e.Type {
 	case jlaftp.EntryTypeFile:
-		return 0
+		perm = 0644
 	case jlaftp.EntryTypeFolder:
-		return fs.ModeDir
+		typ, perm = fs.ModeDir, 0755
 	case jlaftp.EntryTypeLink:
-		return fs.ModeSymlink
+		typ, perm = fs.ModeSymlink, 0777
 	default:
-		panic(fmt.Sprintf("%+v", info))
+		return fs.ModeIrregular
+	}
+	if info.e.hasPerm {
+		perm = info.e.perm
 	}
+	return typ | perm
 }
 
 func (info fileinfo) ModTime() time.Time {
@@ -47,14 +75,72 @@ func (info fileinfo) IsDir() bool {
 	return info.e.Type == jlaftp.EntryTypeFolder
 }
 
+// Sys returns the Entry of the file.
 func (info fileinfo) Sys() any {
-	return info.e
+	e := Entry{Name: info.e.Name, Target: info.e.Target, Type: info.Mode().Type(), Size: info.Size(), ListedSize: info.Size(), Time: info.e.Time}
+	if info.sized {
+		e.ListedSize = info.listed
+	}
+	return e
+}
+
+// Entry is a file as listed by the server, which the Sys method of a fs.FileInfo from a FS returns.
+type Entry struct {
+	Name string
+	// Target is the target of a symlink, if the listing has it.
+	Target string
+	// Type is the type bits of the file mode, such as fs.ModeDir or fs.ModeSymlink, and 0 for a regular file.
+	Type fs.FileMode
+	// Size is the size in the listing, or from the SIZE command, see Stat.
+	Size int64
+	// ListedSize is the size in the listing, which differs from Size if the listing disagrees with SIZE,
+	// see WithSizeCheck.
+	ListedSize int64
+	Time       time.Time
 }
 
-// File is a io/fs.File.
+// File is a io/fs.File, io.Seeker, io.ReaderAt and io.WriterTo.
+// A File returned by Create or Append is write only, and implements io.Writer instead.
+// A directory File is a io/fs.ReadDirFile.
 type File struct {
+	fs   *FS
+	name string
 	info fileinfo
-	resp *jlaftp.Response
+	// target is the name that is read, which differs from name for a followed symlink.
+	target string
+
+	// dirs are the remaining entries of a directory, listed when it is opened.
+	dirs []fs.DirEntry
+
+	// resp is the current retrieval on c, which starts at offset.
+	// It is nil after EOF or a Seek, unless skipped, and is re-issued with REST on the next Read.
+	// c is held from the FS until resp is closed,
+	// and unwatch stops the interruption of resp by the context of the FS.
+	// mu guards them against ReadAt, which may be called concurrently.
+	mu      sync.Mutex
+	c       *jlaftp.ServerConn
+	resp    *jlaftp.Response
+	unwatch func()
+	offset  int64
+	eof     bool
+	// closed is set by Close, after which Close does nothing, and other methods fail with fs.ErrClosed.
+	closed bool
+	// base is the offset in the file of offset 0, for a range from OpenRange, whose length is the size of info.
+	// limited is set if the range ends before the file, so that reads stop at its end.
+	base    int64
+	limited bool
+
+	// w feeds the upload of a File returned by Create or Append, and done receives its result.
+	// done is nil after Sync, until the next Write starts another upload.
+	w    *io.PipeWriter
+	done chan error
+
+	// progress counts the bytes transferred, guarded by mu for reads.
+	progress progress
+	// read counts the bytes read, from the first read at started until Close at ended, guarded by mu.
+	read    int64
+	started time.Time
+	ended   time.Time
 }
 
 // Stat returns the file info.
@@ -62,12 +148,367 @@ func (f *File) Stat() (fs.FileInfo, error) {
 	return f.info, nil
 }
 
-// Stat reads the file.
-func (f *File) Read(b []byte) (int, error) {
-	n, err := f.resp.Read(b)
-	if err == io.EOF {
+// BytesRead returns the bytes transferred so far by Read, ReadAt and WriteTo, and skipped by Seek, see WithSeekSkip.
+// The bytes that Close drains are not counted, see WithDrain.
+func (f *File) BytesRead() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.read
+}
+
+// Elapsed returns the time from the first Read, ReadAt or WriteTo to Close, or until now if the file is still open,
+// which with BytesRead gives the throughput of the transfer. It is 0 before the first read.
+func (f *File) Elapsed() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case f.started.IsZero():
+		return 0
+	case f.ended.IsZero():
+		return time.Since(f.started)
+	}
+	return f.ended.Sub(f.started)
+}
+
+// begin records the time of the first read, and must be called with mu held.
+func (f *File) begin() {
+	if f.started.IsZero() {
+		f.started = time.Now()
+	}
+}
+
+// Read reads the file, and returns io.EOF itself, never wrapped, at its end.
+// A transfer that ends before the size from SIZE fails with a wrapped io.ErrUnexpectedEOF instead.
+func (f *File) Read(b []byte) (n int, err error) {
+	defer f.fs.observe("read", f.name, time.Now(), &err)
+	if f.w != nil {
+		return 0, errors.Errorf("%s not opened for reading", f.name)
+	}
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.begin()
+	if f.eof {
+		return 0, io.EOF
+	}
+	if err := f.retr(); err != nil {
+		return 0, err
+	}
+
+	n, err = f.reader().Read(b)
+	f.offset += int64(n)
+	f.read += int64(n)
+	f.progress.add(f.fs.opts.progress, f.name, n)
+	f.fs.opts.metrics.Transferred("read", int64(n))
+	if errors.Is(err, io.EOF) {
+		// Release the connection as soon as possible for other operations.
+		f.eof = true
+		f.progress.finish(f.fs.opts.progress, f.name)
+		if err := f.closeResp(); err != nil {
+			return n, errors.Wrap(err, "")
+		}
+		if err := f.short(f.offset); err != nil {
+			return n, err
+		}
+		return n, io.EOF
+	}
+	if err != nil {
+		return n, errors.Wrap(f.fs.interrupted(err), "")
+	}
+	return n, nil
+}
+
+// WriteTo writes the rest of the file to w, after which Close has no transfer to drain.
+func (f *File) WriteTo(w io.Writer) (n int64, err error) {
+	defer f.fs.observe("read", f.name, time.Now(), &err)
+	if f.w != nil {
+		return 0, errors.Errorf("%s not opened for reading", f.name)
+	}
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.begin()
+	if f.eof {
+		return 0, nil
+	}
+	if err := f.retr(); err != nil {
+		return 0, err
+	}
+
+	if f.fs.opts.progress != nil {
+		w = progressWriter{w: w, p: &f.progress, fn: f.fs.opts.progress, name: f.name}
+	}
+	n, err = io.Copy(w, f.reader())
+	f.offset += n
+	f.read += n
+	f.fs.opts.metrics.Transferred("read", n)
+	if err != nil {
+		return n, errors.Wrap(f.fs.interrupted(err), "")
+	}
+	f.eof = true
+	f.progress.finish(f.fs.opts.progress, f.name)
+	if err := f.closeResp(); err != nil {
+		return n, errors.Wrap(err, "")
+	}
+	if err := f.short(f.offset); err != nil {
 		return n, err
 	}
+	return n, nil
+}
+
+// reader returns the reader of the retrieval in progress, which ends with the range of OpenRange.
+func (f *File) reader() io.Reader {
+	r := f.fs.limitReader(f.resp)
+	if f.limited {
+		r = io.LimitReader(r, f.info.Size()-f.offset)
+	}
+	return r
+}
+
+// finish closes the retrieval resp held on c as FS.finish,
+// but aborts it rather than draining the rest of the file once at the end of a range, see OpenRange.
+func (f *File) finish(c *jlaftp.ServerConn, resp *jlaftp.Response, eof bool) error {
+	fsys := f.fs
+	if f.limited && eof {
+		v := *fsys
+		v.opts.drain = false
+		fsys, eof = &v, false
+	}
+	return fsys.finish(c, resp, eof)
+}
+
+// short returns io.ErrUnexpectedEOF, wrapped, if a transfer that ended at offset fell short of the size from SIZE.
+// Sizes are those of binary mode, so transfers in ASCII mode are not checked.
+func (f *File) short(offset int64) error {
+	if !f.info.sized || f.fs.opts.ascii || offset >= f.info.Size() {
+		return nil
+	}
+	return errors.Wrapf(io.ErrUnexpectedEOF, "%s: %d of %d bytes", f.name, offset, f.info.Size())
+}
+
+// retr starts the retrieval from offset, unless it is in progress.
+func (f *File) retr() error {
+	if f.resp != nil {
+		return nil
+	}
+	var resp *jlaftp.Response
+	c, err := f.fs.hold(func(c *jlaftp.ServerConn) (err error) {
+		if err := f.fs.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.RetrFrom(f.fs.serverPath(f.target), uint64(f.base+f.offset))
+		f.fs.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return &fs.PathError{Op: "read", Path: f.name, Err: errors.Wrapf(mapErr(err), "RETR from %d", f.offset)}
+	}
+	f.c, f.resp, f.unwatch = c, resp, f.fs.watch(resp)
+	return nil
+}
+
+// ReadDir reads the next n entries of a directory, from the listing read once by Open,
+// so that each File opened on a directory pages through it independently.
+// If n > 0, ReadDir returns at most n entries, and io.EOF once there are none left.
+// If n <= 0, ReadDir returns all remaining entries, and a nil error.
+func (f *File) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	if f.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: fs.ErrClosed}
+	}
+	if n <= 0 {
+		ds := f.dirs
+		f.dirs = nil
+		return ds, nil
+	}
+	if len(f.dirs) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(f.dirs) {
+		n = len(f.dirs)
+	}
+	ds := f.dirs[:n:n]
+	f.dirs = f.dirs[n:]
+	return ds, nil
+}
+
+// Seek sets the offset for the next Read.
+// Seeking forward by at most the bytes set by WithSeekSkip skips them in the transfer in progress.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.w != nil {
+		return 0, errors.Errorf("%s not opened for reading", f.name)
+	}
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		f.mu.Lock()
+		abs = f.offset + offset
+		f.mu.Unlock()
+	case io.SeekEnd:
+		abs = f.info.Size() + offset
+	default:
+		return 0, errors.Errorf("invalid whence %d", whence)
+	}
+	if abs < 0 {
+		return 0, errors.Errorf("negative position %d", abs)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	if abs == f.offset {
+		return abs, nil
+	}
+	if f.resp != nil && abs > f.offset && abs-f.offset <= f.fs.opts.seekSkip {
+		if err := f.skip(abs - f.offset); err == nil {
+			return abs, nil
+		}
+	}
+
+	if err := f.closeResp(); err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+	f.offset = abs
+	f.eof = false
+	return abs, nil
+}
+
+// skip discards the next n bytes of the transfer in progress, see WithSeekSkip.
+// On failure, the offset is left for closeResp and a new retrieval.
+func (f *File) skip(n int64) error {
+	m, err := io.CopyN(io.Discard, f.fs.limitReader(f.resp), n)
+	f.read += m
+	f.fs.opts.metrics.Transferred("read", m)
+	if errors.Is(err, io.EOF) {
+		// Seeking past the end.
+		f.offset += n
+		f.eof = true
+		return errors.Wrap(f.closeResp(), "")
+	}
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	f.offset += n
+	return nil
+}
+
+// ReadAt reads len(b) bytes starting at offset off, with a retrieval of its own.
+// It does not move the offset of Read, but interrupts its transfer,
+// which is resumed with REST by the next Read.
+// After reading len(b) bytes, the retrieval is drained or aborted as in Close, see WithDrain.
+// If the size of the file is from SIZE, see Stat, reads stop at it with io.EOF, without a retrieval past it.
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	defer f.fs.observe("read", f.name, time.Now(), &err)
+	if f.w != nil {
+		return 0, errors.Errorf("%s not opened for reading", f.name)
+	}
+	if f.info.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("is a directory")}
+	}
+	if off < 0 {
+		return 0, errors.Errorf("negative offset %d", off)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	atEnd := false
+	if f.limited || f.info.sized && !f.fs.opts.ascii {
+		if off >= f.info.Size() {
+			return 0, io.EOF
+		}
+		if rest := f.info.Size() - off; int64(len(b)) >= rest {
+			b, atEnd = b[:rest], true
+		}
+	}
+	// Free the connection, which may be the only one of the FS.
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.begin()
+	err = f.closeResp()
+	f.mu.Unlock()
+	if err != nil {
+		return 0, errors.Wrap(err, "")
+	}
+
+	var resp *jlaftp.Response
+	c, err := f.fs.hold(func(c *jlaftp.ServerConn) (err error) {
+		if err := f.fs.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.RetrFrom(f.fs.serverPath(f.target), uint64(f.base+off))
+		f.fs.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.Wrapf(mapErr(err), "RETR from %d", off)}
+	}
+	stop := f.fs.watch(resp)
+	n, err = io.ReadFull(f.fs.limitReader(resp), b)
+	f.fs.opts.metrics.Transferred("read", int64(n))
+	eof := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+	ferr := f.finish(c, resp, eof || atEnd && err == nil)
+	stop()
+	f.mu.Lock()
+	f.read += int64(n)
+	f.progress.add(f.fs.opts.progress, f.name, n)
+	f.mu.Unlock()
+	if ferr != nil {
+		return n, errors.Wrap(f.fs.interrupted(ferr), "")
+	}
+	if eof {
+		if err := f.short(off + int64(n)); err != nil {
+			return n, err
+		}
+		return n, io.EOF
+	}
+	if err != nil {
+		return n, errors.Wrap(f.fs.interrupted(err), "")
+	}
+	if atEnd {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Write writes to a file returned by Create or Append.
+func (f *File) Write(b []byte) (n int, err error) {
+	defer f.fs.observe("write", f.name, time.Now(), &err)
+	if f.w == nil {
+		return 0, errors.Errorf("%s not opened for writing", f.name)
+	}
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.done == nil {
+		// Resume after Sync.
+		if err := f.start("APPE", (*jlaftp.ServerConn).Append); err != nil {
+			return 0, errors.Wrap(err, "")
+		}
+	}
+	n, err = f.w.Write(b)
+	f.info.e.Size += uint64(n)
+	f.progress.add(f.fs.opts.progress, f.name, n)
+	f.fs.opts.metrics.Transferred("write", int64(n))
 	if err != nil {
 		return n, errors.Wrap(err, "")
 	}
@@ -75,94 +516,1044 @@ func (f *File) Read(b []byte) (int, error) {
 }
 
 // Close closes the file.
-func (f *File) Close() error {
-	// Read to the end because of a bug in jlaffaye/ftp.
-	// https://github.com/jlaffaye/ftp/issues/214.
-	if _, err := io.Copy(io.Discard, f.resp); err != nil {
+// For a file returned by Create or Append, Close waits for the server to acknowledge the transfer.
+// Closing a closed file does nothing, and returns nil, whereas its other methods fail with fs.ErrClosed.
+func (f *File) Close() (err error) {
+	defer f.fs.observe("close", f.name, time.Now(), &err)
+	if f.w != nil {
+		if f.closed {
+			return nil
+		}
+		f.closed = true
+		err = f.commit()
+		f.progress.finish(f.fs.opts.progress, f.name)
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	if !f.started.IsZero() {
+		f.ended = time.Now()
+	}
+	f.progress.finish(f.fs.opts.progress, f.name)
+	if err := f.closeResp(); err != nil {
 		return errors.Wrap(err, "")
 	}
+	return nil
+}
 
-	if err := f.resp.Close(); err != nil {
-		log.Printf("%+v", err)
+// Sync ends the upload of a file returned by Create or Append, and waits for the server to acknowledge it,
+// so that what has been written so far is stored, without closing the file.
+// The next Write appends to the file with APPE, in a new transfer.
+// For other files, Sync does nothing.
+func (f *File) Sync() error {
+	if f.w == nil {
+		return nil
+	}
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.commit()
+}
+
+// commit ends the upload of f, if any.
+func (f *File) commit() error {
+	if f.done == nil {
+		return nil
+	}
+	f.w.Close()
+	err := <-f.done
+	f.done = nil
+	if err != nil {
 		return errors.Wrap(err, "")
 	}
 	return nil
 }
 
-// FS is an io/fs.ReadDirFS and io/fs.StatFS.
+func (f *File) closeResp() error {
+	if f.resp == nil {
+		return nil
+	}
+	err := f.finish(f.c, f.resp, f.eof)
+	f.unwatch()
+	f.c, f.resp, f.unwatch = nil, nil, nil
+	return f.fs.interrupted(err)
+}
+
+// FS is an io/fs.ReadDirFS, io/fs.ReadFileFS, io/fs.StatFS, io/fs.GlobFS and io/fs.SubFS.
+// Names are slash separated paths relative to the login directory, which is named ".".
+// As required by io/fs, they are unrooted and clean, without "." or ".." elements nor a trailing slash,
+// and other names fail with fs.ErrInvalid. Clean turns a path into such a name.
+//
+// FS is safe for concurrent use, but each connection handles one operation at a time.
+// In particular, a File holds a connection while it is being read,
+// until it reaches EOF, seeks or is closed.
+// Reading a File does not block on other operations, as it has its own data connection.
+// A FS from NewFS serializes all operations on its single connection,
+// whereas one from NewPoolFS runs them concurrently over several connections.
 type FS struct {
-	c *jlaftp.ServerConn
+	conns *pool
+	opts  options
+	// root is the server path that names are relative to, empty for the login directory.
+	root string
+	// cache holds directory listings by server path, and is nil unless WithDirCache is set.
+	cache *dirCache
+	// ctx interrupts operations, see WithContext.
+	ctx context.Context
+	// trace is nil unless the FS is from WithTracing.
+	trace *tracer
 }
 
-// NewFS returns a file system from a ftp connection.
-func NewFS(c *jlaftp.ServerConn) *FS {
-	fs := &FS{c: c}
+func newFS(conns *pool, o options) *FS {
+	fs := &FS{conns: conns, opts: o, root: o.root, ctx: context.Background()}
+	if o.cacheTTL > 0 {
+		fs.cache = newDirCache(o.cacheTTL, o.cacheMax)
+	}
+	if o.keepAlive > 0 {
+		conns.keepAlive(o.keepAlive, o.logger)
+	}
+	if o.rateLimit > 0 {
+		conns.limiter = newLimiter(o.rateLimit)
+	}
+	if o.absoluteRoot && !path.IsAbs(fs.root) {
+		wd, err := fs.Getwd()
+		if err != nil {
+			o.logger.Printf("%+v", errors.Wrap(err, "absolute root"))
+		} else {
+			fs.root = wd
+		}
+	}
 	return fs
 }
 
+// NewFS returns a file system from a ftp connection, configured by opts as from Dial.
+// The options of the connection itself, such as WithLogin, WithExplicitTLS and the timeouts,
+// do not apply, as c is already open: configure them with the DialWith options of jlaffaye/ftp instead.
+func NewFS(c *jlaftp.ServerConn, opts ...Option) *FS {
+	conns := newPool(nil, 1)
+	conns.idle = []idleConn{{c: c, since: time.Now()}}
+	return newFS(conns, newOptions(opts))
+}
+
+// NewPoolFS returns a file system over at most max connections opened by dial.
+// Connections are opened as needed, and idle ones are checked with NOOP and replaced if dead.
+func NewPoolFS(dial func() (*jlaftp.ServerConn, error), max int, opts ...Option) *FS {
+	return newFS(newPool(dial, max), newOptions(opts))
+}
+
+// Close sends QUIT to the server and closes the connections.
+// Connections in use are closed when their operations finish.
+func (fsys *FS) Close() error {
+	if err := fsys.conns.close(); err != nil {
+		return errors.Wrap(err, "")
+	}
+	return nil
+}
+
+// Invalidate drops the cached listings of the named directory and of its parent,
+// and the cached size and modification time of the named file, so that changes made to name by other clients are seen. See WithDirCache.
+func (fsys *FS) Invalidate(name string) {
+	if fsys.cache == nil {
+		return
+	}
+	fsys.cache.invalidate(fsys.serverPath(name))
+	fsys.cache.invalidate(path.Dir(fsys.serverPath(name)))
+}
+
+// Sub returns a FS rooted at dir, which shares the connections and cache of fsys.
+func (fsys *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return fsys, nil
+	}
+	sub := *fsys
+	sub.root = fsys.join(dir)
+	return &sub, nil
+}
+
+// Chdir changes the directory that names are relative to, to the named directory,
+// after checking that the server can change to it with CWD.
+// As names stay relative, as io/fs requires, the directory is left with Sub rather than "..",
+// and Chdir(dir) is like replacing fsys with the result of Sub(dir).
+// Files that are open, and FSes from Sub, WithContext and ASCII, keep their directory.
+// Chdir must not be called concurrently with other methods of fsys.
+func (fsys *FS) Chdir(dir string) error {
+	if !fs.ValidPath(dir) {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: fs.ErrInvalid}
+	}
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		wd, err := c.CurrentDir()
+		if err != nil {
+			return err
+		}
+		if err := c.ChangeDir(fsys.serverPath(dir)); err != nil {
+			return err
+		}
+		// Server paths relative to the login directory need it to stay the working directory.
+		return c.ChangeDir(wd)
+	})
+	if err != nil {
+		return &fs.PathError{Op: "chdir", Path: dir, Err: errors.WithStack(mapErr(err))}
+	}
+	if dir != "." {
+		fsys.root = fsys.join(dir)
+	}
+	return nil
+}
+
+// Getwd returns the absolute server path of the directory that names are relative to, with PWD,
+// which is the login directory unless the FS is rooted elsewhere, see WithRoot, Sub and Chdir.
+func (fsys *FS) Getwd() (string, error) {
+	if path.IsAbs(fsys.root) {
+		return fsys.root, nil
+	}
+	var wd string
+	err := fsys.do(func(c *jlaftp.ServerConn) (err error) {
+		wd, err = c.CurrentDir()
+		return err
+	})
+	if err != nil {
+		return "", errors.WithStack(mapErr(err))
+	}
+	return path.Join(fsys.decode(wd), fsys.root), nil
+}
+
+// serverPath returns the path of name on the server, in its charset, see WithCharset.
+func (fsys *FS) serverPath(name string) string {
+	return fsys.encode(fsys.join(name))
+}
+
+// join returns the path of name on the server, in UTF-8 as names are.
+func (fsys *FS) join(name string) string {
+	if fsys.root == "" {
+		return name
+	}
+	return path.Join(fsys.root, name)
+}
+
+// Clean returns the name of FS for p, by removing any leading slash and cleaning it as path.Clean.
+// For example, "/a/./b/" and "a//b" become "a/b", and "", "/" and "./" become ".".
+// Names that would escape the top of the FS keep their ".." elements, and still fail.
+func Clean(p string) string {
+	p = strings.TrimLeft(p, "/")
+	if p == "" {
+		return "."
+	}
+	return path.Clean(p)
+}
+
 // Open opens a file.
-func (fs *FS) Open(name string) (fs.File, error) {
-	entry, err := fs.getEntry(name)
+func (fsys *FS) Open(name string) (_ fs.File, err error) {
+	defer fsys.observe("open", name, time.Now(), &err)
+	f, err := fsys.open(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens a file, whose retrieval starts on the first Read if lazy.
+func (fsys *FS) open(name string, lazy bool) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	target, entry, err := fsys.resolve(name, fsys.opts.symlinkDepth)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return fsys.openEntry(name, target, entry, lazy)
+}
+
+// OpenEntry opens the entry d of the directory dir as Open(path.Join(dir, d.Name())),
+// but without listing dir again to find it, when d is from a listing of fsys, such as by ReadDir, WalkDir or ReadDirFunc.
+// Symlinks that WithFollowSymlinks follows, and entries from elsewhere, are looked up as in Open.
+func (fsys *FS) OpenEntry(dir string, d fs.DirEntry) (_ *File, err error) {
+	name := path.Join(dir, d.Name())
+	defer fsys.observe("open", name, time.Now(), &err)
+	if !fs.ValidPath(dir) || !fs.ValidPath(d.Name()) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := d.Info()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fi, ok := info.(fileinfo)
+	if !ok || fi.e.Type == jlaftp.EntryTypeLink && fsys.opts.symlinkDepth > 0 {
+		return fsys.open(name, false)
+	}
+	return fsys.openEntry(name, name, &fi.e, false)
+}
+
+// OpenRange opens the named file as Open, for length bytes from off, such as for an HTTP range request.
+// The File is a file of its own, of the bytes of the range, that Stat reports the size of,
+// and whose offsets, for Seek and ReadAt, are from off.
+// Its retrieval starts at off with REST, and is aborted rather than drained, see WithDrain, once it reaches the end of the range,
+// unless the FS is from NewFS, which always drains.
+// A range that extends past the end of the file is cut short, if the server supports SIZE.
+func (fsys *FS) OpenRange(name string, off, length int64) (_ *File, err error) {
+	defer fsys.observe("open", name, time.Now(), &err)
+	if off < 0 || length < 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := fsys.open(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if f.info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+	size := f.info.Size()
+	if f.info.sized && off+length >= size {
+		length = size - off
+		if length < 0 {
+			length = 0
+		}
+	} else {
+		// The listed size may be inexact.
+		f.limited = true
+	}
+	f.base = off
+	f.info.e.Size = uint64(length)
+	if length == 0 {
+		// Nothing to retrieve, even past the end of the file.
+		f.limited, f.eof = true, true
+		return f, nil
+	}
+	if err := f.retr(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// openEntry opens the file name, whose entry is that of target, see open.
+func (fsys *FS) openEntry(name, target string, entry *listEntry, lazy bool) (*File, error) {
+	info := fileinfo{e: *entry}
+	info.e.Name = path.Base(name)
+	if entry.Type == jlaftp.EntryTypeFolder {
+		ds, err := fsys.readDir(target)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &File{fs: fsys, name: name, info: info, target: target, dirs: ds}, nil
+	}
+	if lazy {
+		if entry.Type == jlaftp.EntryTypeFile {
+			fsys.setSize(&info, target)
+		}
+		return &File{fs: fsys, name: name, info: info, target: target}, nil
+	}
+	var resp *jlaftp.Response
+	c, err := fsys.hold(func(c *jlaftp.ServerConn) (err error) {
+		if entry.Type == jlaftp.EntryTypeFile {
+			size, err := fsys.size(c, fsys.serverPath(target))
+			if err == nil {
+				fsys.checkSize(c, target, info.Size(), size)
+				info.listed, info.sized = info.Size(), true
+				info.e.Size = uint64(size)
+			} else if isConnClosed(err) {
+				return err
+			}
+		}
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.Retr(fsys.serverPath(target))
+		fsys.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	f := &File{fs: fsys, name: name, info: info, target: target, c: c, resp: resp, unwatch: fsys.watch(resp)}
+	return f, nil
+}
+
+// ReadFile reads the named file with a single RETR, without listing its directory.
+// The buffer is preallocated with the size from the SIZE command, if the server supports it.
+// With WithCaseInsensitive, a name that RETR does not find is looked up in the listing of its directory, and retrieved as listed.
+func (fsys *FS) ReadFile(name string) (_ []byte, err error) {
+	defer fsys.observe("readfile", name, time.Now(), &err)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	b, err := fsys.readFile(name, name)
+	if err != nil && fsys.opts.caseInsensitive && errors.Is(err, fs.ErrNotExist) {
+		if target, _, rerr := fsys.resolve(name, 0); rerr == nil && target != name {
+			return fsys.readFile(name, target)
+		}
+	}
+	return b, err
+}
+
+// readFile reads the named file, as its name target on the server.
+func (fsys *FS) readFile(name, target string) ([]byte, error) {
+	var size int64
+	var exact bool
+	var resp *jlaftp.Response
+	c, err := fsys.hold(func(c *jlaftp.ServerConn) (err error) {
+		// SIZE is optional, so its failure is left to RETR to report.
+		size, err = fsys.size(c, fsys.serverPath(target))
+		if isConnClosed(err) {
+			return err
+		}
+		exact = err == nil
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		resp, err = c.Retr(fsys.serverPath(target))
+		fsys.observeCommand("RETR", start, err)
+		return err
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+
+	var buf bytes.Buffer
+	if size > 0 {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	stop := fsys.watch(resp)
+	var p progress
+	n, err := io.Copy(progressWriter{w: &buf, p: &p, fn: fsys.opts.progress, name: name}, fsys.limitReader(resp))
+	fsys.opts.metrics.Transferred("read", n)
+	if ferr := fsys.finish(c, resp, err == nil); ferr != nil && err == nil {
+		err = ferr
+	}
+	stop()
+	p.finish(fsys.opts.progress, name)
+	if err == nil && exact && !fsys.opts.ascii && n < size {
+		err = errors.Wrapf(io.ErrUnexpectedEOF, "%d of %d bytes", n, size)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.WithStack(fsys.interrupted(err))}
+	}
+	return buf.Bytes(), nil
+}
+
+// Stat returns the information of a file, which is a symlink itself unless WithFollowSymlinks is set.
+// The size of a file is from the SIZE command if the server supports it,
+// as the size in directory listings may be inexact.
+// On connections of Dial to a server that advertises MLST, name itself is looked up with MLST, unless listing with LIST, see WithMLSD,
+// and its parent directory is listed only if MLST fails, or names a symlink that WithFollowSymlinks follows.
+// Otherwise, and if the parent directory of name cannot be listed, name is checked to be a directory with CWD,
+// which follows symlinks.
+func (fsys *FS) Stat(name string) (_ fs.FileInfo, err error) {
+	defer fsys.observe("stat", name, time.Now(), &err)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	var target string
+	var entry *listEntry
+	if name != "." {
+		if self, merr := fsys.mlst(name); merr == nil && (self.Type != jlaftp.EntryTypeLink || fsys.opts.symlinkDepth <= 0) {
+			target, entry = name, self
+		}
+	}
+	if entry == nil {
+		target, entry, err = fsys.resolve(name, fsys.opts.symlinkDepth)
+		var perr *parentError
+		if errors.As(err, &perr) && perr.name == name {
+			// The parent may be unlistable, unlike name itself.
+			if self, serr := fsys.statSelf(name); serr == nil {
+				target, entry, err = name, self, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	info := fileinfo{e: *entry}
+	info.e.Name = path.Base(name)
+	if entry.Type == jlaftp.EntryTypeFile {
+		fsys.setSize(&info, target)
+	}
+	return info, nil
+}
+
+// setSize sets the size of info to that of the file target from SIZE,
+// keeping the listed size if SIZE fails.
+func (fsys *FS) setSize(info *fileinfo, target string) {
+	fsys.do(func(c *jlaftp.ServerConn) error {
+		size, err := fsys.size(c, fsys.serverPath(target))
+		if err != nil {
+			return err
+		}
+		fsys.checkSize(c, target, info.Size(), size)
+		info.listed, info.sized = info.Size(), true
+		info.e.Size = uint64(size)
+		return nil
+	})
+}
+
+// checkSize logs a listed size of the file target that disagrees with size from SIZE on c, see WithSizeCheck.
+func (fsys *FS) checkSize(c *jlaftp.ServerConn, target string, listed, size int64) {
+	if !fsys.opts.sizeCheck || listed == size {
+		return
+	}
+	if t := fsys.conns.transport(c); t != nil && t.ascii {
+		return
+	}
+	fsys.opts.logger.Printf("%s is listed with %d bytes, but SIZE reports %d", target, listed, size)
+}
+
+// Exists reports whether the named file exists, as Stat does, but without the SIZE command.
+// Errors other than fs.ErrNotExist, such as a lost connection or fs.ErrPermission, are returned with false.
+func (fsys *FS) Exists(name string) (bool, error) {
+	if !fs.ValidPath(name) {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, _, err := fsys.resolve(name, fsys.opts.symlinkDepth)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return true, nil
+}
+
+// IsDir reports whether the named file is a directory, as Stat does, but without the SIZE command.
+// A missing file is not a directory, and other errors are returned as by Exists.
+func (fsys *FS) IsDir(name string) (bool, error) {
+	if !fs.ValidPath(name) {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, entry, err := fsys.resolve(name, fsys.opts.symlinkDepth)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return entry.Type == jlaftp.EntryTypeFolder, nil
+}
+
+// FileSize returns the size of the named file with the SIZE command, or from the cache, see WithDirCache.
+func (fsys *FS) FileSize(name string) (int64, error) {
+	if !fs.ValidPath(name) {
+		return 0, &fs.PathError{Op: "size", Path: name, Err: fs.ErrInvalid}
+	}
+	var size int64
+	err := fsys.do(func(c *jlaftp.ServerConn) (err error) {
+		size, err = fsys.size(c, fsys.serverPath(name))
+		return err
+	})
+	if err != nil {
+		return 0, &fs.PathError{Op: "size", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	return size, nil
+}
+
+// size returns the size of the file at the server path p with SIZE on c, or from the cache,
+// or ErrUnsupported without a round trip once the server has rejected SIZE.
+func (fsys *FS) size(c *jlaftp.ServerConn, p string) (int64, error) {
+	if atomic.LoadInt32(&fsys.conns.noSize) != 0 {
+		return 0, ErrUnsupported
+	}
+	if fsys.cache != nil {
+		if size, ok := fsys.cache.getSize(p); ok {
+			return size, nil
+		}
+	}
+	start := time.Now()
+	size, err := c.FileSize(p)
+	fsys.observeCommand("SIZE", start, err)
+	if errors.Is(mapErr(err), ErrUnsupported) {
+		atomic.StoreInt32(&fsys.conns.noSize, 1)
+	}
+	if err == nil && fsys.cache != nil {
+		fsys.cache.putSize(p, size)
+	}
+	return size, err
+}
+
+// ModTime returns the modification time of the named file with the MDTM command,
+// which may be more precise than that of directory listings.
+// It fails with ErrUnsupported if the server does not advertise MDTM.
+func (fsys *FS) ModTime(name string) (time.Time, error) {
+	if !fs.ValidPath(name) {
+		return time.Time{}, &fs.PathError{Op: "mdtm", Path: name, Err: fs.ErrInvalid}
+	}
+	p := fsys.serverPath(name)
+	if fsys.cache != nil {
+		if t, ok := fsys.cache.getTime(p); ok {
+			return t, nil
+		}
+	}
+	var t time.Time
+	err := fsys.do(func(c *jlaftp.ServerConn) (err error) {
+		if !c.IsGetTimeSupported() {
+			return ErrUnsupported
+		}
+		start := time.Now()
+		t, err = c.GetTime(p)
+		fsys.observeCommand("MDTM", start, err)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, &fs.PathError{Op: "mdtm", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	if fsys.cache != nil {
+		fsys.cache.putTime(p, t)
+	}
+	return t, nil
+}
+
+// Create creates or truncates the named file, and returns it for writing.
+// The file is uploaded with STOR as it is written, and is complete only after Close returns.
+func (fsys *FS) Create(name string) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: ErrReadOnly}
+	}
+	f, err := fsys.upload(name, "STOR", (*jlaftp.ServerConn).Stor)
+	if err != nil {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// Append opens the named file for appending with APPE, and returns it for writing as Create.
+// Most servers create the file if it does not exist.
+// The size reported by Stat of the returned File counts only the bytes appended.
+func (fsys *FS) Append(name string) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "append", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return nil, &fs.PathError{Op: "append", Path: name, Err: ErrReadOnly}
+	}
+	f, err := fsys.upload(name, "APPE", (*jlaftp.ServerConn).Append)
+	if err != nil {
+		return nil, &fs.PathError{Op: "append", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// OpenFile opens the named file as os.OpenFile, for reading as Open with os.O_RDONLY,
+// or with os.O_WRONLY for writing as Create, or as Append with os.O_APPEND.
+// Files cannot be opened with os.O_RDWR, as FTP cannot read and write a file at once,
+// and a file opened for writing without os.O_APPEND is truncated.
+// Without os.O_CREATE the file must exist, and with os.O_CREATE and os.O_EXCL it must not,
+// which is checked in a listing before the upload starts, and so is not atomic.
+// perm is ignored, as setting it takes another command, see Chmod.
+func (fsys *FS) OpenFile(name string, flag int, perm fs.FileMode) (*File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	switch flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR) {
+	case os.O_RDONLY:
+		return fsys.open(name, false)
+	case os.O_WRONLY:
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.WithStack(ErrUnsupported)}
+	}
+	if fsys.opts.readOnly {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrReadOnly}
+	}
+
+	create, excl := flag&os.O_CREATE != 0, flag&os.O_EXCL != 0
+	if !create || excl {
+		_, err := fsys.getEntry(name)
+		if err == nil && create {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.WithStack(fs.ErrExist)}
+		}
+		if err != nil && !(create && errors.Is(err, fs.ErrNotExist)) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
 	}
-	resp, err := fs.c.Retr(name)
+	cmd, store := "STOR", (*jlaftp.ServerConn).Stor
+	if flag&os.O_APPEND != 0 {
+		cmd, store = "APPE", (*jlaftp.ServerConn).Append
+	}
+	f, err := fsys.upload(name, cmd, store)
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
 	}
-	f := &File{info: fileinfo{e: *entry}, resp: resp}
 	return f, nil
 }
 
-// Stat returns the information of a file.
-func (fs *FS) Stat(name string) (fs.FileInfo, error) {
-	entry, err := fs.getEntry(name)
+// upload returns a File whose writes are streamed to the server by store, which sends cmd.
+func (fsys *FS) upload(name, cmd string, store func(c *jlaftp.ServerConn, path string, r io.Reader) error) (*File, error) {
+	e := listEntry{Entry: jlaftp.Entry{Name: path.Base(name), Type: jlaftp.EntryTypeFile, Time: time.Now()}}
+	f := &File{fs: fsys, name: name, info: fileinfo{e: e}, target: name}
+	if err := f.start(cmd, store); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// start starts a transfer of the writes to f by store, which sends cmd.
+func (f *File) start(cmd string, store func(c *jlaftp.ServerConn, path string, r io.Reader) error) error {
+	fsys := f.fs
+	c, err := fsys.acquire()
+	if err != nil {
+		return err
+	}
+	r, w := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		start := time.Now()
+		err := fsys.run(c, func(c *jlaftp.ServerConn) error {
+			if err := fsys.setType(c); err != nil {
+				return err
+			}
+			return store(c, fsys.serverPath(f.name), fsys.limitReader(r))
+		})
+		fsys.observeCommand(cmd, start, err)
+		fsys.release(c, err)
+		fsys.Invalidate(f.name)
+		// Unblock writers if the server stopped reading early.
+		r.CloseWithError(err)
+		done <- err
+	}()
+	f.w, f.done = w, done
+	return nil
+}
+
+// WriteFileFS is a file system that writes whole files, as FS does with STOR,
+// for generic code that writes through an interface, which io/fs lacks.
+type WriteFileFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// WriteFile writes data to the named file, creating it if necessary.
+// With WithMkdirParents, missing parent directories are created if the first attempt fails.
+// perm is currently ignored, as plain FTP has no standard way to set it.
+func (fsys *FS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+	}
+	err := fsys.writeFile(name, data)
+	if parent := path.Dir(name); err != nil && fsys.opts.mkdirParents && parent != "." {
+		// Which reply a missing directory gets varies, so that any failure is retried.
+		if merr := fsys.mkdirAll(parent, nil); merr != nil {
+			return &fs.PathError{Op: "mkdir", Path: parent, Err: merr}
+		}
+		err = fsys.writeFile(name, data)
+	}
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		return &fs.PathError{Op: "write", Path: name, Err: errors.WithStack(mapErr(err))}
 	}
-	return fileinfo{e: *entry}, nil
+	return nil
 }
 
-// ReadDir reads a directory.
-func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
-	entries, err := fsys.c.List(name)
+func (fsys *FS) writeFile(name string, data []byte) error {
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		start := time.Now()
+		err := c.Stor(fsys.serverPath(name), fsys.limitReader(bytes.NewReader(data)))
+		fsys.observeCommand("STOR", start, err)
+		if err == nil {
+			fsys.opts.metrics.Transferred("write", int64(len(data)))
+		}
+		return err
+	})
+	fsys.Invalidate(name)
+	return err
+}
+
+// ReadDir reads a directory, sorted by name unless WithReadDirOrder is set.
+// The Type and Info of the entries are from the listing, and need no further command:
+// Type is fs.ModeDir for a directory, fs.ModeSymlink for a symlink, which is not followed, and 0 for a file.
+func (fsys *FS) ReadDir(name string) (_ []fs.DirEntry, err error) {
+	defer fsys.observe("readdir", name, time.Now(), &err)
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	ds, err := fsys.readDirOrdered(name)
 	if err != nil {
-		return nil, errors.Wrap(err, "")
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return ds, nil
+}
+
+// ReadDirNames returns the names in a directory, sorted, as listed by NLST,
+// which lists bare names, and so is cheaper than the listing of ReadDir for large directories.
+// A cached listing serves it instead, see WithDirCache.
+// WithSkipHidden applies, but WithDirFilter does not, as it needs the entries of ReadDir.
+// Servers that reply 450 to NLST on an empty directory, such as ProFTPD, list no names.
+func (fsys *FS) ReadDirNames(name string) ([]string, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	dir := fsys.serverPath(name)
+	var listed []string
+	var entries []*listEntry
+	cached := false
+	if fsys.cache != nil {
+		entries, cached = fsys.cache.get(dir)
+	}
+	if cached {
+		for _, e := range entries {
+			listed = append(listed, e.Name)
+		}
+	} else {
+		err := fsys.do(func(c *jlaftp.ServerConn) (err error) {
+			start := time.Now()
+			listed, err = c.NameList(dir)
+			fsys.observeCommand("NLST", start, err)
+			var reply *textproto.Error
+			if errors.As(err, &reply) && reply.Code == jlaftp.StatusFileActionIgnored {
+				listed, err = nil, nil
+			}
+			return err
+		})
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.WithStack(mapErr(err))}
+		}
+		for i, n := range listed {
+			listed[i] = fsys.decode(baseName(n))
+		}
+	}
+
+	names := make([]string, 0, len(listed))
+	for _, n := range listed {
+		if n == "." || n == ".." || n == "" || fsys.opts.skipHidden && strings.HasPrefix(n, ".") {
+			continue
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readDir lists a directory sorted by name, as io/fs requires.
+func (fsys *FS) readDir(name string) ([]fs.DirEntry, error) {
+	ds, err := fsys.listDir(name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Name() < ds[j].Name() })
+	return ds, nil
+}
+
+// listDir lists a directory in the order of the server.
+func (fsys *FS) listDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fsys.list(fsys.serverPath(name))
+	if err != nil {
+		return nil, errors.WithStack(mapErr(err))
 	}
-	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
 	ds := make([]fs.DirEntry, 0, len(entries))
 	for _, e := range entries {
-		switch e.Name {
-		case ".":
-			continue
-		case "..":
-			continue
+		if e.Type == jlaftp.EntryTypeLink && fsys.opts.dirSymlinkDepth > 0 {
+			e = fsys.linkedEntry(name, e)
+		}
+		if d, ok := fsys.dirEntry(e); ok {
+			ds = append(ds, d)
 		}
-		ds = append(ds, fs.FileInfoToDirEntry(fileinfo{e: *e}))
 	}
 	return ds, nil
 }
 
-func (fs *FS) getEntry(name string) (*jlaftp.Entry, error) {
-	parent := path.Dir(name)
-	entries, err := fs.c.List(parent)
+// dirEntry returns the listed entry e, unless it is skipped from listings.
+func (fsys *FS) dirEntry(e *listEntry) (fs.DirEntry, bool) {
+	switch e.Name {
+	case ".":
+		return nil, false
+	case "..":
+		return nil, false
+	}
+	if fsys.opts.skipHidden && strings.HasPrefix(e.Name, ".") {
+		return nil, false
+	}
+	d := fs.FileInfoToDirEntry(fileinfo{e: *e})
+	if fsys.opts.dirFilter != nil && !fsys.opts.dirFilter(d) {
+		return nil, false
+	}
+	return d, true
+}
+
+// list lists the directory at the server path dir, from the cache if possible.
+// Connections opened by Dial list with MLSD unless it is disabled or rejected, see WithMLSD.
+// The returned slice may be modified, but not the entries.
+func (fsys *FS) list(dir string) ([]*listEntry, error) {
+	if fsys.cache != nil {
+		if entries, ok := fsys.cache.get(dir); ok {
+			return entries, nil
+		}
+	}
+	var entries []*listEntry
+	err := fsys.do(func(c *jlaftp.ServerConn) (err error) {
+		entries = nil
+		err = fsys.streamMLSD(c, dir, func(e *listEntry) bool {
+			entries = append(entries, e)
+			return true
+		})
+		if err == nil {
+			atomic.StoreInt32(&fsys.conns.listFormat, formatMLSD)
+		}
+		if !errors.Is(mapErr(err), ErrUnsupported) {
+			return err
+		}
+		entries, err = fsys.listLIST(c, dir)
+		if err == nil && fsys.conns.transport(c) != nil {
+			atomic.StoreInt32(&fsys.conns.listFormat, formatLIST)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		fsys.listed(e)
+	}
+	if fsys.cache != nil {
+		fsys.cache.put(dir, entries)
+	}
+	return entries, nil
+}
+
+// baseName returns the name of a listed entry without its directory,
+// as some servers list full paths rather than base names.
+func baseName(name string) string {
+	if !strings.Contains(name, "/") {
+		return name
+	}
+	return path.Base(name)
+}
+
+// parentError is the failure of getEntry to list the parent directory of name.
+type parentError struct {
+	name string
+	err  error
+}
+
+func (e *parentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *parentError) Unwrap() error {
+	return e.err
+}
+
+// mlst returns the entry of name from MLST, which only connections of Dial can send.
+func (fsys *FS) mlst(name string) (*listEntry, error) {
+	feats, err := fsys.features()
+	if err != nil {
+		return nil, err
+	}
+	// The facts of MLST are those of MLSD, which a FS listing with LIST would not agree with.
+	if !hasFeature(feats, "MLST") || !fsys.opts.mlsd || atomic.LoadInt32(&fsys.conns.noMLSD) != 0 {
+		return nil, errors.WithStack(ErrUnsupported)
+	}
+	var entry *listEntry
+	err = fsys.do(func(c *jlaftp.ServerConn) error {
+		_, msg, err := fsys.command(c, jlaftp.StatusRequestedFileActionOK, "MLST %s", fsys.serverPath(name))
+		if err != nil {
+			return err
+		}
+		// The entry is the line that starts with a space, between the lines of the reply.
+		for _, line := range strings.Split(msg, "\n") {
+			if !strings.HasPrefix(line, " ") {
+				continue
+			}
+			if entry, err = parseMLSD(strings.TrimSpace(line)); err == nil && entry == nil {
+				// name is the working directory or its parent, which Stat looks up otherwise.
+				err = errors.Errorf("no entry in MLST reply %q", msg)
+			}
+			return err
+		}
+		return errors.Errorf("no entry in MLST reply %q", msg)
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("%s", parent))
+		return nil, errors.WithStack(mapErr(err))
+	}
+	fsys.listed(entry)
+	return entry, nil
+}
+
+// statSelf checks that name is a directory with CWD, without listing its parent directory, see Stat.
+func (fsys *FS) statSelf(name string) (*listEntry, error) {
+	p := fsys.serverPath(name)
+	c, err := fsys.acquire()
+	if err != nil {
+		return nil, err
+	}
+	moved := false
+	err = fsys.run(c, func(c *jlaftp.ServerConn) error {
+		wd, err := c.CurrentDir()
+		if err != nil {
+			return err
+		}
+		if err := c.ChangeDir(p); err != nil {
+			return err
+		}
+		if err := c.ChangeDir(wd); err != nil {
+			moved = true
+			return err
+		}
+		return nil
+	})
+	if moved && fsys.conns.dial != nil {
+		// Names would be resolved from name rather than from the login directory.
+		fsys.conns.discard(c)
+	} else {
+		fsys.release(c, err)
+	}
+	if err != nil {
+		return nil, errors.WithStack(mapErr(err))
+	}
+	return &listEntry{Entry: jlaftp.Entry{Name: path.Base(name), Type: jlaftp.EntryTypeFolder}}, nil
+}
+
+// getEntry finds name in the listing of its parent directory.
+// A single MLST is cheaper, but jlaffaye/ftp does not expose it, so that only Stat sends it on connections of Dial,
+// and LIST of a file cannot be told apart from the listing of a directory containing
+// a file of the same name. WithDirCache saves the repeated listings.
+func (fsys *FS) getEntry(name string) (*listEntry, error) {
+	// The root does not appear in any listing, as ReadDir skips ".".
+	if name == "." {
+		return &listEntry{Entry: jlaftp.Entry{Name: ".", Type: jlaftp.EntryTypeFolder}}, nil
+	}
+
+	p := fsys.serverPath(name)
+	parent := path.Dir(p)
+	if parent == p {
+		// A path that is its own parent, such as "/", would be looked up in its own listing.
+		return &listEntry{Entry: jlaftp.Entry{Name: ".", Type: jlaftp.EntryTypeFolder}}, nil
+	}
+	entries, err := fsys.list(parent)
+	if err != nil {
+		return nil, &parentError{name: name, err: errors.Wrap(mapErr(err), fmt.Sprintf("%s", parent))}
 	}
 	base := path.Base(name)
-	var entry *jlaftp.Entry
+	var entry *listEntry
 	for _, e := range entries {
 		if e.Name == base {
 			entry = e
 			break
 		}
 	}
-	if entry == nil {
-		derefed := make([]jlaftp.Entry, 0, len(entries))
+	if entry == nil && fsys.opts.caseInsensitive {
 		for _, e := range entries {
-			derefed = append(derefed, *e)
+			if !strings.EqualFold(e.Name, base) {
+				continue
+			}
+			if entry != nil {
+				return nil, errors.Errorf("%s is ambiguous, matching %s and %s", name, entry.Name, e.Name)
+			}
+			entry = e
 		}
-		return nil, errors.Errorf("%s %+v", base, derefed)
+	}
+	if entry == nil {
+		return nil, errors.Wrapf(fs.ErrNotExist, "%s not listed in %s", base, parent)
 	}
 	return entry, nil
 }
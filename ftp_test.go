@@ -0,0 +1,670 @@
+package ftp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fumin/ftp"
+	"github.com/fumin/ftp/ftptest"
+)
+
+// newServer starts a ftptest server of files.
+func newServer(t *testing.T, files fs.FS, opts ...ftptest.Option) *ftptest.Server {
+	t.Helper()
+	srv, err := ftptest.NewServer(files, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// dial dials srv with opts.
+func dial(t *testing.T, srv *ftptest.Server, opts ...ftp.Option) *ftp.FS {
+	t.Helper()
+	fsys, err := ftp.Dial(context.Background(), srv.Addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+func TestDirEntryType(t *testing.T) {
+	files := fstest.MapFS{
+		"dir/file.txt":    {Data: []byte("hello")},
+		"dir/sub/sub.txt": {Data: []byte("sub")},
+		"dir/link":        {Data: []byte("file.txt"), Mode: fs.ModeSymlink},
+	}
+	want := map[string]fs.FileMode{"file.txt": 0, "sub": fs.ModeDir, "link": fs.ModeSymlink}
+	for _, format := range []string{"MLSD", "LIST"} {
+		srv := newServer(t, files)
+		fsys := dial(t, srv, ftp.WithMLSD(format == "MLSD"))
+		ds, err := fsys.ReadDir("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsys.ListFormat() != format {
+			t.Fatalf("listed with %s, want %s", fsys.ListFormat(), format)
+		}
+		// Type and Info are from the listing, without the server.
+		srv.Close()
+		if len(ds) != len(want) {
+			t.Errorf("%s: %d entries, want %d", format, len(ds), len(want))
+		}
+		for _, d := range ds {
+			typ, ok := want[d.Name()]
+			if !ok {
+				t.Errorf("%s: unexpected entry %s", format, d.Name())
+				continue
+			}
+			if d.Type() != typ {
+				t.Errorf("%s: %s has type %v, want %v", format, d.Name(), d.Type(), typ)
+			}
+			if d.IsDir() != (typ == fs.ModeDir) {
+				t.Errorf("%s: %s IsDir %v", format, d.Name(), d.IsDir())
+			}
+			info, err := d.Info()
+			if err != nil {
+				t.Errorf("%s: %s: %v", format, d.Name(), err)
+				continue
+			}
+			if info.Mode().Type() != typ || info.Name() != d.Name() {
+				t.Errorf("%s: %s has info %s %v", format, d.Name(), info.Name(), info.Mode())
+			}
+		}
+	}
+}
+
+func TestFullPathListings(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{
+		"a.txt":            {Data: []byte("a")},
+		"dir/file.txt":     {Data: []byte("hello")},
+		"dir/sub/deep.txt": {Data: []byte("deep")},
+	}, ftptest.WithFullPaths(true))
+	for _, format := range []string{"MLSD", "LIST"} {
+		fsys := dial(t, srv, ftp.WithMLSD(format == "MLSD"))
+
+		ds, err := fsys.ReadDir("dir")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, d := range ds {
+			names = append(names, d.Name())
+		}
+		if got, want := strings.Join(names, " "), "file.txt sub"; got != want {
+			t.Errorf("%s: ReadDir lists %q, want %q", format, got, want)
+		}
+
+		for name, size := range map[string]int64{"a.txt": 1, "dir/file.txt": 5, "dir/sub/deep.txt": 4} {
+			info, err := fsys.Stat(name)
+			if err != nil {
+				t.Errorf("%s: %v", format, err)
+				continue
+			}
+			if info.Name() != path.Base(name) || info.Size() != size {
+				t.Errorf("%s: Stat(%s) = %s of %d bytes", format, name, info.Name(), info.Size())
+			}
+		}
+		if info, err := fsys.Stat("dir/sub"); err != nil || !info.IsDir() {
+			t.Errorf("%s: Stat(dir/sub) = %v, %v", format, info, err)
+		}
+
+		names, err = fsys.ReadDirNames("dir/sub")
+		if err != nil || strings.Join(names, " ") != "deep.txt" {
+			t.Errorf("%s: ReadDirNames(dir/sub) = %q, %v", format, names, err)
+		}
+
+		var walked []string
+		err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			walked = append(walked, name)
+			return err
+		})
+		if got, want := strings.Join(walked, " "), ". a.txt dir dir/file.txt dir/sub dir/sub/deep.txt"; err != nil || got != want {
+			t.Errorf("%s: walked %q, %v, want %q", format, got, err, want)
+		}
+	}
+}
+
+func TestFileInfoMode(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{
+		"private.txt": {Data: []byte("secret"), Mode: 0600},
+		"public":      {Mode: fs.ModeDir | 0711},
+	})
+	for _, test := range []struct {
+		format string
+		want   map[string]fs.FileMode
+	}{
+		// The permission bits are in the unix.mode facts of MLSD.
+		{"MLSD", map[string]fs.FileMode{"private.txt": 0600, "public": fs.ModeDir | 0711}},
+		// jlaffaye/ftp does not parse those of LIST.
+		{"LIST", map[string]fs.FileMode{"private.txt": 0644, "public": fs.ModeDir | 0755}},
+	} {
+		fsys := dial(t, srv, ftp.WithMLSD(test.format == "MLSD"))
+		ds, err := fsys.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, d := range ds {
+			info, err := d.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode() != test.want[d.Name()] {
+				t.Errorf("%s: %s has mode %v, want %v", test.format, d.Name(), info.Mode(), test.want[d.Name()])
+			}
+		}
+		info, err := fsys.Stat("private.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != test.want["private.txt"] {
+			t.Errorf("%s: Stat has mode %v, want %v", test.format, info.Mode(), test.want["private.txt"])
+		}
+	}
+}
+
+func TestTopLevelNames(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{
+		"file.txt":     {Data: []byte("top")},
+		"dir/file.txt": {Data: []byte("nested")},
+		"dir/dir":      {Mode: fs.ModeDir},
+	})
+	for _, test := range []struct {
+		desc string
+		opts []ftp.Option
+	}{
+		{"relative root", nil},
+		{"root /", []ftp.Option{ftp.WithRoot("/")}},
+		{"absolute root", []ftp.Option{ftp.WithAbsoluteRoot(true)}},
+	} {
+		fsys := dial(t, srv, test.opts...)
+		for _, name := range []string{"file.txt", "dir", "dir/file.txt", "dir/dir"} {
+			wantDir := path.Base(name) == "dir"
+			// Stat looks names up with MLST first, unlike IsDir.
+			isDir, err := fsys.IsDir(name)
+			if err != nil || isDir != wantDir {
+				t.Errorf("%s: IsDir(%s) = %v, %v, want %v", test.desc, name, isDir, err, wantDir)
+			}
+			info, err := fsys.Stat(name)
+			if err != nil {
+				t.Errorf("%s: %v", test.desc, err)
+				continue
+			}
+			if info.Name() != path.Base(name) || info.IsDir() != wantDir {
+				t.Errorf("%s: Stat(%s) = %s, dir %v", test.desc, name, info.Name(), info.IsDir())
+			}
+		}
+		if b, err := fsys.ReadFile("file.txt"); err != nil || string(b) != "top" {
+			t.Errorf("%s: ReadFile(file.txt) = %q, %v", test.desc, b, err)
+		}
+		for _, name := range []string{"missing.txt", "dir/missing.txt", "file.txt/x"} {
+			if _, err := fsys.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("%s: Stat(%s) = %v, want %v", test.desc, name, err, fs.ErrNotExist)
+			}
+		}
+	}
+}
+
+// open opens name of fsys as a *ftp.File.
+func open(t *testing.T, fsys *ftp.FS, name string) *ftp.File {
+	t.Helper()
+	f, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f.(*ftp.File)
+}
+
+func TestFileSeek(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{"file.txt": {Data: []byte("hello, world")}}))
+	f := open(t, fsys, "file.txt")
+
+	for _, test := range []struct {
+		offset int64
+		whence int
+		pos    int64
+		want   string
+	}{
+		{7, io.SeekStart, 7, "world"},
+		{-5, io.SeekEnd, 7, "world"},
+		{0, io.SeekStart, 0, "hello, world"},
+	} {
+		pos, err := f.Seek(test.offset, test.whence)
+		if err != nil || pos != test.pos {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", test.offset, test.whence, pos, err, test.pos)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil || string(b) != test.want {
+			t.Errorf("after Seek(%d, %d), read %q, %v, want %q", test.offset, test.whence, b, err, test.want)
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(f, b); err != nil || string(b) != "hello" {
+		t.Fatalf("read %q, %v", b, err)
+	}
+	if pos, err := f.Seek(2, io.SeekCurrent); err != nil || pos != 7 {
+		t.Fatalf("Seek(2, io.SeekCurrent) = %d, %v, want 7", pos, err)
+	}
+	if b, err := io.ReadAll(f); err != nil || string(b) != "world" {
+		t.Errorf("after Seek(2, io.SeekCurrent), read %q, %v, want %q", b, err, "world")
+	}
+
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Errorf("no error seeking to a negative offset")
+	}
+	if _, err := f.Seek(-13, io.SeekEnd); err == nil {
+		t.Errorf("no error seeking before the start from the end")
+	}
+}
+
+func TestFS(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{
+		"a.txt":            {Data: []byte("a")},
+		"dir/file.txt":     {Data: []byte("hello, world")},
+		"dir/sub/deep.txt": {Data: []byte("deep")},
+		"empty":            {Mode: fs.ModeDir},
+	})
+	for _, format := range []string{"MLSD", "LIST"} {
+		fsys := dial(t, srv, ftp.WithMLSD(format == "MLSD"))
+		if err := fstest.TestFS(fsys, "a.txt", "dir/file.txt", "dir/sub/deep.txt", "empty"); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+		if fsys.ListFormat() != format {
+			t.Errorf("listed with %s, want %s", fsys.ListFormat(), format)
+		}
+	}
+}
+
+func TestFileReadAt(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{"file.txt": {Data: []byte("hello, world")}}))
+	f := open(t, fsys, "file.txt")
+
+	for _, test := range []struct {
+		off  int64
+		size int
+		want string
+		err  error
+	}{
+		{7, 3, "wor", nil},
+		{0, 5, "hello", nil},
+		// Reads that reach the end tell so.
+		{7, 5, "world", io.EOF},
+		{7, 10, "world", io.EOF},
+		{12, 1, "", io.EOF},
+		{20, 1, "", io.EOF},
+	} {
+		b := make([]byte, test.size)
+		n, err := f.ReadAt(b, test.off)
+		if string(b[:n]) != test.want || err != test.err {
+			t.Errorf("ReadAt(%d bytes at %d) = %q, %v, want %q, %v", test.size, test.off, b[:n], err, test.want, test.err)
+		}
+	}
+	if _, err := f.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Errorf("no error reading at a negative offset")
+	}
+
+	// ReadAt leaves the offset of Read as is.
+	if b, err := io.ReadAll(f); err != nil || string(b) != "hello, world" {
+		t.Errorf("read %q, %v", b, err)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{
+		"file.txt": {Data: []byte("hello")},
+		"twin.txt": {Data: []byte("twin")},
+		"TWIN.txt": {Data: []byte("TWIN")},
+	}), ftp.WithCaseInsensitive(true))
+
+	info, err := fsys.Stat("FILE.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 5 || info.IsDir() {
+		t.Errorf("Stat(FILE.TXT) = size %d, dir %v, want file.txt", info.Size(), info.IsDir())
+	}
+	b, err := fs.ReadFile(fsys, "FILE.TXT")
+	if err != nil || string(b) != "hello" {
+		t.Errorf("ReadFile(FILE.TXT) = %q, %v, want %q", b, err, "hello")
+	}
+	if b, err := io.ReadAll(open(t, fsys, "File.Txt")); err != nil || string(b) != "hello" {
+		t.Errorf("reading File.Txt = %q, %v, want %q", b, err, "hello")
+	}
+
+	// An exact match wins over the names that differ only in case.
+	if info, err := fsys.Stat("TWIN.txt"); err != nil || info.Size() != 4 {
+		t.Errorf("Stat(TWIN.txt) = %v, %v", info, err)
+	}
+	if _, err := fsys.Stat("Twin.txt"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("Stat(Twin.txt) = %v, want an error for an ambiguous name", err)
+	}
+	if _, err := fsys.Stat("missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(missing.txt) = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestFileReadDir(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{
+		"d/a.txt": {Data: []byte("a")},
+		"d/b.txt": {Data: []byte("b")},
+		"d/c":     {Mode: fs.ModeDir},
+	}))
+	names := func(ds []fs.DirEntry) string {
+		var s []string
+		for _, d := range ds {
+			s = append(s, d.Name())
+		}
+		return strings.Join(s, " ")
+	}
+
+	f := open(t, fsys, "d")
+	var paged []fs.DirEntry
+	for {
+		ds, err := f.ReadDir(1)
+		if err == io.EOF {
+			if len(ds) != 0 {
+				t.Errorf("ReadDir(1) = %s, io.EOF, want no entries", names(ds))
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ds) != 1 {
+			t.Fatalf("ReadDir(1) = %s, want one entry", names(ds))
+		}
+		paged = append(paged, ds...)
+	}
+	if got := names(paged); got != "a.txt b.txt c" {
+		t.Errorf("paged through %s, want a.txt b.txt c", got)
+	}
+	if _, err := f.ReadDir(1); err != io.EOF {
+		t.Errorf("ReadDir(1) at the end = %v, want io.EOF", err)
+	}
+
+	// Each File pages through the directory of its own, and n <= 0 returns the rest.
+	for _, n := range []int{0, -1} {
+		f := open(t, fsys, "d")
+		ds, err := f.ReadDir(n)
+		if err != nil || names(ds) != "a.txt b.txt c" {
+			t.Errorf("ReadDir(%d) = %s, %v, want a.txt b.txt c", n, names(ds), err)
+		}
+		if ds, err := f.ReadDir(n); err != nil || len(ds) != 0 {
+			t.Errorf("ReadDir(%d) at the end = %s, %v, want no entries and a nil error", n, names(ds), err)
+		}
+	}
+	f = open(t, fsys, "d")
+	if ds, err := f.ReadDir(2); err != nil || names(ds) != "a.txt b.txt" {
+		t.Errorf("ReadDir(2) = %s, %v, want a.txt b.txt", names(ds), err)
+	}
+	if ds, err := f.ReadDir(0); err != nil || names(ds) != "c" {
+		t.Errorf("ReadDir(0) after ReadDir(2) = %s, %v, want c", names(ds), err)
+	}
+}
+
+func TestStatMLST(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{
+		"dir/private.txt": {Data: []byte("secret"), Mode: 0600},
+		"dir/sub":         {Mode: fs.ModeDir | 0711},
+	})
+	for _, test := range []struct {
+		name string
+		mode fs.FileMode
+		size int64
+	}{
+		{"dir/private.txt", 0600, 6},
+		{"dir/sub", fs.ModeDir | 0711, 0},
+		// fstest.MapFS gives implied directories the mode 0555.
+		{"dir", fs.ModeDir | 0555, 0},
+	} {
+		var cmds commandLog
+		fsys := dial(t, srv, ftp.WithDialer(cmds.dial))
+		info, err := fsys.Stat(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name() != path.Base(test.name) || info.Mode() != test.mode || info.Size() != test.size {
+			t.Errorf("Stat(%s) = %s, mode %v, size %d, want mode %v, size %d", test.name, info.Name(), info.Mode(), info.Size(), test.mode, test.size)
+		}
+		// The name is looked up with MLST, rather than in the listing of its directory.
+		if cmds.count("MLST") != 1 || cmds.count("MLSD") != 0 || cmds.count("LIST") != 0 {
+			t.Errorf("Stat(%s) sent MLST %d times, MLSD %d times and LIST %d times, want MLST only", test.name, cmds.count("MLST"), cmds.count("MLSD"), cmds.count("LIST"))
+		}
+	}
+
+	// A name that MLST does not find is looked up in the listing still.
+	fsys := dial(t, srv)
+	if _, err := fsys.Stat("dir/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Stat(dir/missing.txt) = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	// Listing with LIST, Stat does not use MLST, whose facts would disagree with the listing.
+	var cmds commandLog
+	fsys = dial(t, srv, ftp.WithMLSD(false), ftp.WithDialer(cmds.dial))
+	if _, err := fsys.Stat("dir/private.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := cmds.count("MLST"); n != 0 {
+		t.Errorf("Stat with WithMLSD(false) sent MLST %d times", n)
+	}
+}
+
+// logs is a ftp.Logger that records the messages.
+type logs struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *logs) Printf(format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+}
+
+func TestSizeCheck(t *testing.T) {
+	// SIZE reports more bytes than the listing and the transfer have.
+	srv := newServer(t, fstest.MapFS{"file.txt": {Data: []byte("hello")}}, ftptest.WithSizeFunc(func(name string, size int64) int64 {
+		return size + 3
+	}))
+	var l logs
+	fsys := dial(t, srv, ftp.WithSizeCheck(true), ftp.WithLogger(&l))
+
+	if _, err := fsys.ReadFile("file.txt"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadFile = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	b, err := io.ReadAll(open(t, fsys, "file.txt"))
+	if string(b) != "hello" || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading file.txt = %q, %v, want %q, %v", b, err, "hello", io.ErrUnexpectedEOF)
+	}
+
+	info, err := fsys.Stat("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 8 {
+		t.Errorf("Stat has size %d, want the 8 bytes from SIZE", info.Size())
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.msgs) == 0 || !strings.Contains(l.msgs[len(l.msgs)-1], "listed with 5 bytes, but SIZE reports 8") {
+		t.Errorf("logged %q, want the disagreement of the sizes", l.msgs)
+	}
+}
+
+func TestFileCloseTwice(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{
+		"file.txt": {Data: []byte("hello, world")},
+		"dir/a":    {Data: []byte("a")},
+	}))
+	for _, test := range []struct {
+		name string
+		read int
+	}{
+		{"file.txt", 0},
+		// Closing in the middle of the transfer ends it once.
+		{"file.txt", 5},
+		{"file.txt", 100},
+		{"dir", 0},
+	} {
+		f := open(t, fsys, test.name)
+		if test.read > 0 {
+			if _, err := f.Read(make([]byte, test.read)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("%s, read %d bytes: Close = %v", test.name, test.read, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("%s, read %d bytes: second Close = %v, want nil", test.name, test.read, err)
+		}
+		// The connection is left usable.
+		if b, err := fsys.ReadFile("file.txt"); err != nil || string(b) != "hello, world" {
+			t.Errorf("%s, read %d bytes: ReadFile after Close = %q, %v", test.name, test.read, b, err)
+		}
+	}
+}
+
+func TestFileClosed(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{"file.txt": {Data: []byte("hello, world")}, "dir/a": {}}))
+	for _, read := range []int{0, 5, 100} {
+		f := open(t, fsys, "file.txt")
+		if read > 0 {
+			if _, err := f.Read(make([]byte, read)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := f.Read(make([]byte, 5)); n != 0 || !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("read %d bytes: Read after Close = %d, %v, want %v", read, n, err, fs.ErrClosed)
+		}
+		if _, err := f.ReadAt(make([]byte, 5), 0); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("read %d bytes: ReadAt after Close = %v, want %v", read, err, fs.ErrClosed)
+		}
+		if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("read %d bytes: Seek after Close = %v, want %v", read, err, fs.ErrClosed)
+		}
+		if _, err := f.WriteTo(io.Discard); !errors.Is(err, fs.ErrClosed) {
+			t.Errorf("read %d bytes: WriteTo after Close = %v, want %v", read, err, fs.ErrClosed)
+		}
+	}
+
+	d := open(t, fsys, "dir")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadDir(-1); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("ReadDir after Close = %v, want %v", err, fs.ErrClosed)
+	}
+}
+
+func TestReadDirNames(t *testing.T) {
+	files := fstest.MapFS{
+		"dir/b.txt": {Data: []byte("b")},
+		"dir/a.txt": {Data: []byte("a")},
+		"dir/sub":   {Mode: fs.ModeDir},
+		"empty":     {Mode: fs.ModeDir},
+	}
+	for _, nlst450 := range []bool{false, true} {
+		fsys := dial(t, newServer(t, files, ftptest.WithEmptyNLST450(nlst450)))
+		names, err := fsys.ReadDirNames("dir")
+		if err != nil || strings.Join(names, " ") != "a.txt b.txt sub" {
+			t.Errorf("450 %v: ReadDirNames(dir) = %q, %v, want a.txt b.txt sub", nlst450, names, err)
+		}
+		// A 450 reply to NLST of an empty directory lists no names.
+		names, err = fsys.ReadDirNames("empty")
+		if err != nil || names == nil || len(names) != 0 {
+			t.Errorf("450 %v: ReadDirNames(empty) = %#v, %v, want an empty slice and a nil error", nlst450, names, err)
+		}
+		// The connection is left usable.
+		if b, err := fsys.ReadFile("dir/a.txt"); err != nil || string(b) != "a" {
+			t.Errorf("450 %v: ReadFile after ReadDirNames = %q, %v", nlst450, b, err)
+		}
+	}
+}
+
+func TestOpenRange(t *testing.T) {
+	srv := newServer(t, fstest.MapFS{"file.txt": {Data: []byte("hello, world")}})
+	fsys := dial(t, srv)
+	for _, test := range []struct {
+		off, length int64
+		want        string
+	}{
+		{7, 3, "wor"},
+		{0, 5, "hello"},
+		// Ranges past the end of the file are cut short.
+		{7, 100, "world"},
+		{12, 5, ""},
+		{20, 5, ""},
+	} {
+		f, err := fsys.OpenRange("file.txt", test.off, test.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil || string(b) != test.want {
+			t.Errorf("OpenRange(%d, %d) read %q, %v, want %q", test.off, test.length, b, err, test.want)
+		}
+		if info, err := f.Stat(); err != nil || info.Size() != int64(len(test.want)) {
+			t.Errorf("OpenRange(%d, %d) has size %d, %v, want %d", test.off, test.length, info.Size(), err, len(test.want))
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("OpenRange(%d, %d): Close = %v", test.off, test.length, err)
+		}
+	}
+
+	for _, test := range []struct {
+		desc string
+		// read reads f up to where it is closed.
+		read func(f io.Reader) error
+		// reused is whether the transfer is drained, and the connection used again.
+		reused bool
+	}{
+		{"closed early", func(f io.Reader) error {
+			_, err := io.ReadFull(f, make([]byte, 1))
+			return err
+		}, true},
+		// The transfer is aborted at the end of the range, and the connection replaced.
+		{"read to the end of the range", func(f io.Reader) error {
+			_, err := io.ReadAll(f)
+			return err
+		}, false},
+	} {
+		var cmds commandLog
+		fsys := dial(t, srv, ftp.WithDialer(cmds.dial))
+		f, err := fsys.OpenRange("file.txt", 7, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := test.read(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("%s: Close = %v", test.desc, err)
+		}
+		if b, err := fsys.ReadFile("file.txt"); err != nil || string(b) != "hello, world" {
+			t.Errorf("%s: ReadFile after Close = %q, %v", test.desc, b, err)
+		}
+		// commandLog records the commands of the first connection only.
+		if reused := cmds.count("RETR") == 2; reused != test.reused {
+			t.Errorf("%s: connection used again %v, want %v", test.desc, reused, test.reused)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+// Package ftptest provides a FTP server for tests, which serves an io/fs.FS such as a fstest.MapFS.
+//
+//	srv, err := ftptest.NewServer(fstest.MapFS{"dir/file.txt": {Data: []byte("hello")}})
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer srv.Close()
+//	fsys, err := ftp.Dial(ctx, srv.Addr)
+package ftptest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dataTimeout bounds the wait for the client to open a data connection.
+const dataTimeout = 10 * time.Second
+
+// Server is a FTP server on a local port, which accepts any login.
+// It is read only, and rejects commands that modify files with 502.
+// Listings are in both the MLSD and the unix LIST formats, with MLST for single names, and data connections are passive.
+// Symlinks are listed with their targets if the fs.FS has a ReadLink method, as fstest.MapFS has since Go 1.25.
+type Server struct {
+	// Addr is the address of the server, such as "127.0.0.1:2121".
+	Addr string
+
+	fsys fs.FS
+	opts options
+	l    net.Listener
+	wg   sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// An Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	fullPaths bool
+	epsv      bool
+	size      func(name string, size int64) int64
+	nlst450   bool
+	stall     string
+}
+
+// WithFullPaths sets whether listings name entries by their absolute paths, such as "/dir/file.txt",
+// as some servers do, rather than by their names in the listed directory, which is the default.
+func WithFullPaths(enabled bool) Option {
+	return func(o *options) {
+		o.fullPaths = enabled
+	}
+}
+
+// WithEPSV sets whether the server accepts EPSV, as in RFC 2428, which is the default,
+// or rejects it with 502 and accepts only PASV, as older servers and some firewalls do.
+func WithEPSV(enabled bool) Option {
+	return func(o *options) {
+		o.epsv = enabled
+	}
+}
+
+// WithSizeFunc sets a function that returns the size that SIZE reports for the file name of the given size,
+// which is its size by default, as for servers whose SIZE disagrees with their listings and transfers.
+func WithSizeFunc(fn func(name string, size int64) int64) Option {
+	return func(o *options) {
+		o.size = fn
+	}
+}
+
+// WithEmptyNLST450 sets whether NLST of an empty directory fails with 450, as with ProFTPD,
+// rather than listing no names, which is the default.
+func WithEmptyNLST450(enabled bool) Option {
+	return func(o *options) {
+		o.nlst450 = enabled
+	}
+}
+
+// WithStall sets a command, such as "PASS", that the server never replies to, as a server that hangs,
+// so that the client waits for the reply until it gives up or the server is closed.
+// The default is "", which stalls no command.
+func WithStall(cmd string) Option {
+	return func(o *options) {
+		o.stall = strings.ToUpper(cmd)
+	}
+}
+
+// NewServer starts a server for fsys on a local port.
+// The root of the server, which is also the login directory, is the root of fsys.
+func NewServer(fsys fs.FS, opts ...Option) (*Server, error) {
+	o := options{epsv: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Wrap(err, "")
+	}
+	s := &Server{Addr: l.Addr().String(), fsys: fsys, opts: o, l: l, conns: make(map[net.Conn]struct{})}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops the server, and closes its connections.
+func (s *Server) Close() error {
+	err := s.l.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	return nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			sess := &session{fsys: s.fsys, opts: s.opts, ctrl: conn, r: bufio.NewReader(conn), cwd: "/"}
+			sess.serve()
+			sess.closePassive()
+			conn.Close()
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// session is the state of a control connection.
+type session struct {
+	fsys fs.FS
+	opts options
+	ctrl net.Conn
+	r    *bufio.Reader
+	// cwd is the working directory, as an absolute path.
+	cwd string
+	// pasv listens for the next data connection, and is nil until EPSV or PASV.
+	pasv net.Listener
+	// rest is the offset of the next RETR, from REST.
+	rest int64
+}
+
+func (s *session) reply(code int, format string, args ...any) {
+	fmt.Fprintf(s.ctrl, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+}
+
+func (s *session) serve() {
+	s.reply(220, "ftptest ready")
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !s.do(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+// do runs a command, and reports whether the session goes on.
+func (s *session) do(cmd, arg string) bool {
+	if cmd == s.opts.stall {
+		return true
+	}
+	switch cmd {
+	case "USER":
+		s.reply(331, "Password required")
+	case "PASS":
+		s.reply(230, "Logged in")
+	case "QUIT":
+		s.reply(221, "Bye")
+		return false
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+	case "FEAT":
+		fmt.Fprintf(s.ctrl, "211-Features:\r\n MDTM\r\n MLST type*;size*;modify*;UNIX.mode*;\r\n REST STREAM\r\n SIZE\r\n UTF8\r\n211 End\r\n")
+	case "OPTS", "TYPE", "NOOP":
+		s.reply(200, "OK")
+	case "PWD":
+		s.reply(257, "%q is the current directory", s.cwd)
+	case "CWD":
+		s.cwdTo(arg)
+	case "CDUP":
+		s.cwdTo("..")
+	case "EPSV", "PASV":
+		if cmd == "EPSV" && !s.opts.epsv {
+			s.reply(502, "Use PASV")
+			break
+		}
+		s.passive(cmd)
+	case "REST":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			s.reply(501, "Invalid offset")
+			break
+		}
+		s.rest = n
+		s.reply(350, "Restarting at %d", n)
+	case "SIZE":
+		info, err := fs.Stat(s.fsys, s.name(arg))
+		if err != nil || info.IsDir() {
+			s.reply(550, "No such file")
+			break
+		}
+		size := info.Size()
+		if s.opts.size != nil {
+			size = s.opts.size(s.name(arg), size)
+		}
+		s.reply(213, "%d", size)
+	case "MDTM":
+		info, err := fs.Stat(s.fsys, s.name(arg))
+		if err != nil {
+			s.reply(550, "No such file")
+			break
+		}
+		s.reply(213, "%s", info.ModTime().UTC().Format("20060102150405"))
+	case "MLST":
+		s.mlst(arg)
+	case "LIST", "NLST", "MLSD":
+		s.list(cmd, arg)
+	case "RETR":
+		s.retr(arg)
+	default:
+		s.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// name returns the name in fsys of the path arg, relative to the working directory.
+func (s *session) name(arg string) string {
+	p := arg
+	if !path.IsAbs(p) {
+		p = path.Join(s.cwd, p)
+	}
+	p = path.Clean(p)
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+func (s *session) cwdTo(arg string) {
+	name := s.name(arg)
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil || !info.IsDir() {
+		s.reply(550, "No such directory")
+		return
+	}
+	s.cwd = path.Join("/", name)
+	s.reply(250, "OK")
+}
+
+func (s *session) passive(cmd string) {
+	s.closePassive()
+	host, _, _ := net.SplitHostPort(s.ctrl.LocalAddr().String())
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		s.reply(425, "Cannot listen: %v", err)
+		return
+	}
+	s.pasv = l
+	port := l.Addr().(*net.TCPAddr).Port
+	if cmd == "EPSV" {
+		s.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+		return
+	}
+	ip := l.Addr().(*net.TCPAddr).IP.To4()
+	if ip == nil {
+		s.closePassive()
+		s.reply(425, "Use EPSV")
+		return
+	}
+	s.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+}
+
+func (s *session) closePassive() {
+	if s.pasv != nil {
+		s.pasv.Close()
+		s.pasv = nil
+	}
+}
+
+// transfer replies 150, and sends the output of send on the data connection.
+func (s *session) transfer(send func(w io.Writer) error) {
+	if s.pasv == nil {
+		s.reply(425, "Use EPSV or PASV first")
+		return
+	}
+	l := s.pasv
+	s.pasv = nil
+	defer l.Close()
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(dataTimeout))
+	conn, err := l.Accept()
+	if err != nil {
+		s.reply(425, "Cannot open data connection: %v", err)
+		return
+	}
+	s.reply(150, "Opening data connection")
+	w := bufio.NewWriter(conn)
+	err = send(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	conn.Close()
+	if err != nil {
+		s.reply(426, "Transfer aborted: %v", err)
+		return
+	}
+	s.reply(226, "Transfer complete")
+}
+
+func (s *session) list(cmd, arg string) {
+	// Options such as "-a" are ignored.
+	for strings.HasPrefix(arg, "-") {
+		_, arg, _ = strings.Cut(arg, " ")
+	}
+	name := s.name(arg)
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		s.closePassive()
+		s.reply(550, "No such file or directory")
+		return
+	}
+	// dir is the directory of the listed names, if they are full paths.
+	dir := "/"
+	var ds []fs.DirEntry
+	if info.IsDir() {
+		dir = path.Join("/", name)
+		if ds, err = fs.ReadDir(s.fsys, name); err != nil {
+			s.closePassive()
+			s.reply(550, "%v", err)
+			return
+		}
+	} else {
+		ds = []fs.DirEntry{fs.FileInfoToDirEntry(info)}
+		dir = path.Dir(path.Join("/", name))
+	}
+	if cmd == "NLST" && len(ds) == 0 && s.opts.nlst450 {
+		s.closePassive()
+		s.reply(450, "No files found")
+		return
+	}
+	s.transfer(func(w io.Writer) error {
+		if cmd == "MLSD" && info.IsDir() {
+			fmt.Fprintf(w, "type=cdir;modify=%s; .\r\n", info.ModTime().UTC().Format("20060102150405"))
+		}
+		for _, d := range ds {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			listed := d.Name()
+			if s.opts.fullPaths {
+				listed = path.Join(dir, listed)
+			}
+			var target string
+			if info.Mode()&fs.ModeSymlink != 0 {
+				target = s.readLink(s.name(path.Join(dir, d.Name())))
+			}
+			switch cmd {
+			case "NLST":
+				fmt.Fprintf(w, "%s\r\n", listed)
+			case "MLSD":
+				fmt.Fprintf(w, "%s\r\n", mlsdLine(info, listed, target))
+			default:
+				fmt.Fprintf(w, "%s\r\n", listLine(info, listed, target))
+			}
+		}
+		return nil
+	})
+}
+
+// mlst replies with the facts of arg itself, as in RFC 3659, which for a symlink are of the symlink rather than its target.
+func (s *session) mlst(arg string) {
+	name := s.name(arg)
+	info, err := s.lstat(name)
+	if err != nil {
+		s.reply(550, "No such file or directory")
+		return
+	}
+	var target string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target = s.readLink(name)
+	}
+	fmt.Fprintf(s.ctrl, "250-Listing %s\r\n %s\r\n250 End\r\n", arg, mlsdLine(info, path.Join("/", name), target))
+}
+
+// lstat returns the information of name without following a symlink, from the listing of its directory.
+func (s *session) lstat(name string) (fs.FileInfo, error) {
+	if name == "." {
+		return fs.Stat(s.fsys, name)
+	}
+	ds, err := fs.ReadDir(s.fsys, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range ds {
+		if d.Name() == path.Base(name) {
+			return d.Info()
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+// readLinker is a fs.FS that reads symlinks, such as the fs.ReadLinkFS of Go 1.25.
+type readLinker interface {
+	ReadLink(name string) (string, error)
+}
+
+// readLink returns the target of the symlink name, or "" if it cannot be read.
+func (s *session) readLink(name string) string {
+	l, ok := s.fsys.(readLinker)
+	if !ok {
+		return ""
+	}
+	target, err := l.ReadLink(name)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+// mlsdLine formats info as in a MLSD listing, naming it name, with the target of a symlink if known.
+func mlsdLine(info fs.FileInfo, name, target string) string {
+	typ := "file"
+	switch {
+	case info.IsDir():
+		typ = "dir"
+	case info.Mode()&fs.ModeSymlink != 0:
+		typ = "OS.unix=slink"
+		if target != "" {
+			typ += ":" + target
+		}
+	}
+	return fmt.Sprintf("type=%s;size=%d;modify=%s;UNIX.mode=%04o; %s", typ, info.Size(), info.ModTime().UTC().Format("20060102150405"), info.Mode().Perm(), name)
+}
+
+// listLine formats info as in a unix LIST listing, naming it name, with the target of a symlink if known.
+func listLine(info fs.FileInfo, name, target string) string {
+	mode := []byte(info.Mode().Perm().String())
+	switch {
+	case info.IsDir():
+		mode[0] = 'd'
+	case info.Mode()&fs.ModeSymlink != 0:
+		mode[0] = 'l'
+	}
+	t := info.ModTime().UTC()
+	stamp := t.Format("Jan _2 15:04")
+	if t.Year() != time.Now().UTC().Year() {
+		stamp = t.Format("Jan _2  2006")
+	}
+	if target != "" {
+		name += " -> " + target
+	}
+	return fmt.Sprintf("%s 1 owner group %d %s %s", mode, info.Size(), stamp, name)
+}
+
+func (s *session) retr(arg string) {
+	offset := s.rest
+	s.rest = 0
+	f, err := s.fsys.Open(s.name(arg))
+	if err != nil {
+		s.closePassive()
+		s.reply(550, "No such file")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		s.closePassive()
+		s.reply(550, "Not a file")
+		return
+	}
+	s.transfer(func(w io.Writer) error {
+		if offset >= info.Size() {
+			// A restart at or past the end transfers nothing, as with most servers.
+			return nil
+		}
+		if offset > 0 {
+			if seeker, ok := f.(io.Seeker); ok {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return err
+				}
+			} else if _, err := io.CopyN(io.Discard, f, offset); err != nil && err != io.EOF {
+				return err
+			}
+		}
+		_, err := io.Copy(w, f)
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+package ftp
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Glob returns the names of all files matching pattern, with the syntax of path.Match.
+// As with fs.Glob, file system errors are ignored, and only malformed patterns are reported.
+// Only directories that can contain a match are listed,
+// and a literal prefix such as "logs" in "logs/2024-*/*.gz" is listed directly.
+func (fsys *FS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return fsys.glob(pattern, false)
+}
+
+// glob returns the files matching pattern, or only the directories if dirOnly.
+func (fsys *FS) glob(pattern string, dirOnly bool) ([]string, error) {
+	if !hasMeta(pattern) {
+		info, err := fsys.Stat(pattern)
+		if err != nil || (dirOnly && !isDirLike(info.Mode())) {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	dir, file := path.Split(pattern)
+	dir = cleanGlobPath(dir)
+	if !hasMeta(dir) {
+		return fsys.globDir(dir, file, dirOnly, nil)
+	}
+	// Prevent infinite recursion.
+	if dir == pattern {
+		return nil, path.ErrBadPattern
+	}
+
+	dirs, err := fsys.glob(dir, true)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, d := range dirs {
+		matches, err = fsys.globDir(d, file, dirOnly, matches)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return matches, nil
+}
+
+// globDir appends the entries of dir matching pattern to matches.
+func (fsys *FS) globDir(dir, pattern string, dirOnly bool, matches []string) ([]string, error) {
+	ds, err := fsys.readDir(dir)
+	if err != nil {
+		return matches, nil
+	}
+	for _, d := range ds {
+		if dirOnly && !isDirLike(d.Type()) {
+			continue
+		}
+		ok, err := path.Match(pattern, d.Name())
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, path.Join(dir, d.Name()))
+		}
+	}
+	return matches, nil
+}
+
+// isDirLike reports whether a file of mode may be listed as a directory.
+// Symlinks may point to directories, so they are kept.
+func isDirLike(mode fs.FileMode) bool {
+	return mode.IsDir() || mode&fs.ModeSymlink != 0
+}
+
+// hasMeta reports whether path contains any magic glob characters.
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[\`)
+}
+
+// cleanGlobPath prepares path for glob matching.
+func cleanGlobPath(path string) string {
+	switch path {
+	case "":
+		return "."
+	default:
+		return path[0 : len(path)-1] // chop off trailing separator
+	}
+}
@@ -0,0 +1,46 @@
+package ftp_test
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGlob(t *testing.T) {
+	fsys := dial(t, newServer(t, fstest.MapFS{
+		"a.txt":            {Data: []byte("a")},
+		"b.txt":            {Data: []byte("b")},
+		"c.log":            {Data: []byte("c")},
+		"dir/file.txt":     {Data: []byte("hello")},
+		"dir/sub/deep.txt": {Data: []byte("deep")},
+		"other/x.txt":      {Data: []byte("x")},
+	}))
+	for _, test := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.txt", []string{"a.txt", "b.txt"}},
+		{"dir/*", []string{"dir/file.txt", "dir/sub"}},
+		{"*/*.txt", []string{"dir/file.txt", "other/x.txt"}},
+		{"dir/sub/deep.txt", []string{"dir/sub/deep.txt"}},
+		{"*.gz", nil},
+		{"missing/*", nil},
+	} {
+		got, err := fsys.Glob(test.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", test.pattern, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(test.want, " ") || (got == nil) != (test.want == nil) {
+			t.Errorf("Glob(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	for _, pattern := range []string{"[", "dir/[a-"} {
+		if got, err := fsys.Glob(pattern); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Glob(%q) = %q, %v, want %v", pattern, got, err, path.ErrBadPattern)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package ftp
+
+import (
+	"io/fs"
+	"strings"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// hashCommands are the non-standard commands that reply with the hash of a file, by algorithm.
+var hashCommands = map[string]string{
+	"CRC32":   "XCRC",
+	"MD5":     "XMD5",
+	"SHA-1":   "XSHA1",
+	"SHA-256": "XSHA256",
+	"SHA-512": "XSHA512",
+}
+
+// Hash returns the hash of the named file as computed by the server, in lower case hexadecimal,
+// so that a download can be verified without reading the file twice.
+// algo is one of the names of the HASH command, "CRC32", "MD5", "SHA-1", "SHA-256" or "SHA-512".
+// The HASH command is used if the server advertises algo for it in its reply to FEAT, see Features,
+// and otherwise XCRC, XMD5, XSHA1, XSHA256 or XSHA512 if advertised.
+// It fails with ErrUnsupported if neither is, or if fsys was not opened by Dial.
+func (fsys *FS) Hash(name, algo string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: fs.ErrInvalid}
+	}
+	feats, err := fsys.features()
+	if err != nil {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: err}
+	}
+	algo = strings.ToUpper(algo)
+
+	var sum string
+	switch xcmd, ok := hashCommands[algo]; {
+	case hashAdvertised(feats["HASH"], algo):
+		err = fsys.do(func(c *jlaftp.ServerConn) error {
+			// The algorithm is a setting of the connection, so it is set every time.
+			if _, _, err := fsys.command(c, jlaftp.StatusCommandOK, "OPTS HASH %s", algo); err != nil {
+				return err
+			}
+			_, msg, err := fsys.command(c, jlaftp.StatusFile, "HASH %s", fsys.serverPath(name))
+			if err != nil {
+				return err
+			}
+			// The reply is the algorithm, the range of bytes, the hash and the name, as "SHA-256 0-49 169cd22282da7f147cb491e559e9dd filename".
+			if fields := strings.Fields(msg); len(fields) >= 3 {
+				sum = fields[2]
+			}
+			return nil
+		})
+	case ok && hasFeature(feats, xcmd):
+		err = fsys.do(func(c *jlaftp.ServerConn) error {
+			// Servers reply 213 or 250, with the hash first.
+			_, msg, err := fsys.command(c, 2, "%s %s", xcmd, fsys.serverPath(name))
+			if err != nil {
+				return err
+			}
+			if fields := strings.Fields(msg); len(fields) >= 1 {
+				sum = strings.TrimPrefix(strings.ToLower(fields[0]), "0x")
+			}
+			return nil
+		})
+	default:
+		err = errors.WithStack(ErrUnsupported)
+	}
+	if err != nil {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	if sum == "" {
+		return "", &fs.PathError{Op: "hash", Path: name, Err: errors.New("no hash in reply")}
+	}
+	return strings.ToLower(sum), nil
+}
+
+// hashAdvertised reports whether algo is among the parameters of the HASH feature,
+// which are separated by semicolons, with a star on the current one, as "SHA-1;SHA-256*;MD5".
+func hashAdvertised(params, algo string) bool {
+	for _, a := range strings.Split(params, ";") {
+		if strings.EqualFold(strings.TrimSuffix(a, "*"), algo) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFeature reports whether the server advertises the feature name, which may have no parameters.
+func hasFeature(feats map[string]string, name string) bool {
+	_, ok := feats[name]
+	return ok
+}
@@ -0,0 +1,28 @@
+package ftp
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// HTTPFS returns a http.FileSystem serving fsys, such as with http.FileServer.
+// Unlike with http.FS(fsys), a file is retrieved on its first read rather than when it is opened,
+// so that requests answered without its content, such as HEAD, do not start a transfer.
+// Serving a file whose content type is sniffed seeks back to its start,
+// which drains the rest of the first retrieval unless WithDrain(false) is set.
+func HTTPFS(fsys *FS) http.FileSystem {
+	return http.FS(lazyFS{fsys})
+}
+
+// lazyFS opens files lazily for HTTPFS.
+type lazyFS struct {
+	fsys *FS
+}
+
+func (l lazyFS) Open(name string) (fs.File, error) {
+	f, err := l.fsys.open(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,113 @@
+package ftp_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fumin/ftp"
+	"github.com/fumin/ftp/ftptest"
+)
+
+// serveHTTP serves files with http.FileServer and HTTPFS, from a ftptest server of files.
+func serveHTTP(t *testing.T, files fstest.MapFS) *httptest.Server {
+	t.Helper()
+	fsys := dial(t, newServer(t, files))
+	ts := httptest.NewServer(http.FileServer(ftp.HTTPFS(fsys)))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestHTTPFSRange(t *testing.T) {
+	ts := serveHTTP(t, fstest.MapFS{"dir/file.txt": {Data: []byte("hello, world")}})
+
+	resp, body := get(t, ts.URL+"/dir/file.txt", http.Header{"Range": {"bytes=7-11"}})
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusPartialContent)
+	}
+	if body != "world" {
+		t.Errorf("body %q, want %q", body, "world")
+	}
+	if got, want := resp.Header.Get("Content-Range"), "bytes 7-11/12"; got != want {
+		t.Errorf("Content-Range %q, want %q", got, want)
+	}
+
+	resp, body = get(t, ts.URL+"/dir/file.txt", nil)
+	if resp.StatusCode != http.StatusOK || body != "hello, world" {
+		t.Errorf("status %d body %q, want %d %q", resp.StatusCode, body, http.StatusOK, "hello, world")
+	}
+}
+
+func TestHTTPFSDirectory(t *testing.T) {
+	ts := serveHTTP(t, fstest.MapFS{
+		"dir/file.txt":    {Data: []byte("hello")},
+		"dir/sub/sub.txt": {Data: []byte("sub")},
+	})
+
+	resp, body := get(t, ts.URL+"/dir/", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	for _, link := range []string{`<a href="file.txt">file.txt</a>`, `<a href="sub/">sub/</a>`} {
+		if !strings.Contains(body, link) {
+			t.Errorf("listing %q does not contain %s", body, link)
+		}
+	}
+
+	resp, _ = get(t, ts.URL+"/dir/missing.txt", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d for a missing file, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func ExampleHTTPFS() {
+	srv, err := ftptest.NewServer(fstest.MapFS{"hello.txt": {Data: []byte("hello, world\n")}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srv.Close()
+	fsys, err := ftp.Dial(context.Background(), srv.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer fsys.Close()
+
+	ts := httptest.NewServer(http.FileServer(ftp.HTTPFS(fsys)))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/hello.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		log.Fatal(err)
+	}
+	// Output: hello, world
+}
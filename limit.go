@@ -0,0 +1,87 @@
+package ftp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithRateLimit caps the transfers of files to and from the server at rate bytes per second,
+// which applies to all of them together, including ReadFile, WriteFile and WriteTo.
+// Directory listings are not limited.
+func WithRateLimit(rate int64) Option {
+	return func(o *options) {
+		o.rateLimit = rate
+	}
+}
+
+// limiter is a token bucket, which lets transfers run into debt and then waits it out.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate int64) *limiter {
+	burst := float64(rate) / 10
+	if burst < 4096 {
+		burst = 4096
+	}
+	return &limiter{rate: float64(rate), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n tokens, and waits until the debt is paid or ctx is done.
+func (l *limiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := -l.tokens
+	l.mu.Unlock()
+	if debt <= 0 {
+		return nil
+	}
+	t := time.NewTimer(time.Duration(debt / l.rate * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// limitReader returns r limited by WithRateLimit, or r itself without a limit.
+func (fsys *FS) limitReader(r io.Reader) io.Reader {
+	if fsys.conns.limiter == nil {
+		return r
+	}
+	return limitedReader{r: r, l: fsys.conns.limiter, ctx: fsys.ctx}
+}
+
+type limitedReader struct {
+	r   io.Reader
+	l   *limiter
+	ctx context.Context
+}
+
+func (lr limitedReader) Read(b []byte) (int, error) {
+	if len(b) > int(lr.l.burst) {
+		b = b[:int(lr.l.burst)]
+	}
+	n, err := lr.r.Read(b)
+	if werr := lr.l.wait(lr.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
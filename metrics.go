@@ -0,0 +1,51 @@
+package ftp
+
+import (
+	"io"
+	"time"
+)
+
+// Metrics observes a FS, such as to export counters and latencies to a monitoring system.
+// Its methods are called concurrently, and should return quickly.
+type Metrics interface {
+	// Operation is called when an operation returns, with op one of "open", "stat", "readdir" and "readfile" of FS,
+	// "read", "write" and "close" of File, where ReadAt and WriteTo are reads.
+	// err is nil on success, including for a read that reaches the end of the file.
+	Operation(op string, d time.Duration, err error)
+	// Command is called when the server replies to one of the commands LIST, MLSD, NLST, RETR, STOR, APPE, SIZE and MDTM.
+	// The reply to RETR starts the transfer, whereas those to STOR and APPE end it.
+	Command(cmd string, d time.Duration, err error)
+	// Transferred is called with n bytes read from or written to a data connection, with op "read" or "write".
+	Transferred(op string, n int64)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Operation(op string, d time.Duration, err error) {}
+func (nopMetrics) Command(cmd string, d time.Duration, err error)  {}
+func (nopMetrics) Transferred(op string, n int64)                  {}
+
+// WithMetrics reports the operations, commands and transfers of the FS to m, which discards them by default.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// observe reports the operation op on name started at start, to be deferred with the address of the returned error.
+func (fsys *FS) observe(op, name string, start time.Time, err *error) {
+	e := *err
+	if e == io.EOF {
+		e = nil
+	}
+	d := time.Since(start)
+	fsys.opts.metrics.Operation(op, d, e)
+	if fsys.trace != nil {
+		fsys.trace.printf(op, name, d, e)
+	}
+}
+
+// observeCommand reports the command cmd sent at start.
+func (fsys *FS) observeCommand(cmd string, start time.Time, err error) {
+	fsys.opts.metrics.Command(cmd, time.Since(start), err)
+}
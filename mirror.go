@@ -0,0 +1,173 @@
+package ftp
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A MirrorOption configures Mirror.
+type MirrorOption func(*mirrorOptions)
+
+type mirrorOptions struct {
+	delete  bool
+	modTime bool
+}
+
+// MirrorDelete sets whether Mirror removes the files and directories of dst that are not in src,
+// including those that WithSkipHidden or WithDirFilter leave out of listings.
+func MirrorDelete(enabled bool) MirrorOption {
+	return func(o *mirrorOptions) {
+		o.delete = enabled
+	}
+}
+
+// MirrorModTime sets whether Mirror also uploads files that are older on dst than in src,
+// rather than only those whose size differs, and sets the modification time of uploaded files to that in src.
+// Setting it needs MFMT, without which files remain newer on dst than in src, and so are not uploaded again.
+func MirrorModTime(enabled bool) MirrorOption {
+	return func(o *mirrorOptions) {
+		o.modTime = enabled
+	}
+}
+
+// Mirror uploads to dst the regular files of the tree rooted at root in src that are missing on dst or differ,
+// under the same names, creating directories as needed.
+// Files are compared by their sizes in the listings of dst, and by modification time with MirrorModTime.
+// A file of dst where src has a directory, or the other way around, is replaced only with MirrorDelete.
+// Files of src other than regular files and directories, such as symlinks, are skipped.
+func Mirror(dst *FS, src fs.FS, root string, opts ...MirrorOption) error {
+	var o mirrorOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	info, err := fs.Stat(src, root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		remote, err := dst.Stat(root)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err == nil && !o.differs(info, remote) {
+			return nil
+		}
+		return dst.mirrorFile(src, root, info, o)
+	}
+	if err := dst.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	return dst.mirrorDir(src, root, o)
+}
+
+// mirrorDir mirrors the directory name of src to fsys, where it exists.
+func (fsys *FS) mirrorDir(src fs.FS, name string, o mirrorOptions) error {
+	local, err := fs.ReadDir(src, name)
+	if err != nil {
+		return err
+	}
+	// Hidden and filtered out entries are seen too, see WithDirFilter, as they would be in the way of uploads.
+	remote, err := fsys.list(fsys.serverPath(name))
+	if err != nil {
+		return &fs.PathError{Op: "readdir", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	remotes := make(map[string]fileinfo, len(remote))
+	for _, e := range remote {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		remotes[e.Name] = fileinfo{e: *e}
+	}
+
+	for _, d := range local {
+		child := path.Join(name, d.Name())
+		r, ok := remotes[d.Name()]
+		delete(remotes, d.Name())
+		if !d.IsDir() && !d.Type().IsRegular() {
+			continue
+		}
+		if ok && r.IsDir() != d.IsDir() {
+			if !o.delete {
+				return &fs.PathError{Op: "mirror", Path: child, Err: errors.New("file type differs")}
+			}
+			if err := fsys.RemoveAll(child); err != nil {
+				return err
+			}
+			ok = false
+		}
+
+		if d.IsDir() {
+			if !ok {
+				if err := fsys.Mkdir(child, 0755); err != nil {
+					return err
+				}
+			}
+			if err := fsys.mirrorDir(src, child, o); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if ok && !o.differs(info, r) {
+			continue
+		}
+		if err := fsys.mirrorFile(src, child, info, o); err != nil {
+			return err
+		}
+	}
+
+	if o.delete {
+		for _, e := range remote {
+			if _, ok := remotes[e.Name]; !ok {
+				continue
+			}
+			if err := fsys.RemoveAll(path.Join(name, e.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// differs reports whether the remote file needs the upload of the local one.
+func (o mirrorOptions) differs(local, remote fs.FileInfo) bool {
+	if local.Size() != remote.Size() {
+		return true
+	}
+	// Listings are precise to the second at best.
+	return o.modTime && remote.ModTime().Before(local.ModTime().Truncate(time.Second))
+}
+
+// mirrorFile uploads the file name of src, whose info is given, to fsys.
+func (fsys *FS) mirrorFile(src fs.FS, name string, info fs.FileInfo, o mirrorOptions) error {
+	r, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := fsys.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return &fs.PathError{Op: "mirror", Path: name, Err: errors.WithStack(err)}
+	}
+	if err := w.Close(); err != nil {
+		return &fs.PathError{Op: "mirror", Path: name, Err: err}
+	}
+	if o.modTime {
+		err := fsys.Chtimes(name, info.ModTime(), info.ModTime())
+		if err != nil && !errors.Is(err, ErrUnsupported) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package ftp
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// Formats of directory listings, see ListFormat.
+const (
+	formatUnknown int32 = iota
+	formatMLSD
+	formatLIST
+)
+
+// WithMLSD sets whether directories are listed with MLSD, as in RFC 3659, which is the default,
+// rather than with LIST, whose format varies across servers and is parsed heuristically.
+// MLSD is used on connections opened by Dial unless the server rejects it, after which LIST is used.
+// Stat uses MLST only while listing with MLSD, so that both agree.
+// On other connections, jlaffaye/ftp uses MLSD if the server advertises MLST in FEAT, regardless of WithMLSD.
+func WithMLSD(enabled bool) Option {
+	return func(o *options) {
+		o.mlsd = enabled
+	}
+}
+
+// ListFormat returns the format of the directory listings read from the server, "MLSD" or "LIST".
+// It is empty until a directory is listed on a connection opened by Dial,
+// and for other connections, whose format is picked by jlaffaye/ftp, see WithMLSD.
+func (fsys *FS) ListFormat() string {
+	switch atomic.LoadInt32(&fsys.conns.listFormat) {
+	case formatMLSD:
+		return "MLSD"
+	case formatLIST:
+		return "LIST"
+	}
+	return ""
+}
+
+// parseMLSD parses a line of a MLSD listing, as in RFC 3659, such as
+// "type=file;size=6;modify=20240102150405; a.txt".
+// The permission bits are from the unix.mode fact, or else from the perm fact, see fileinfo.Mode.
+// Other facts than these and type, size and modify are ignored.
+// The entry is nil for the lines of type cdir and pdir, which are the listed directory and its parent,
+// named as the server pleases, such as "/tmp" or "tmp", rather than "." and "..".
+func parseMLSD(line string) (*listEntry, error) {
+	i := strings.IndexByte(line, ' ')
+	if i < 0 {
+		return nil, errors.Errorf("malformed MLSD line %q", line)
+	}
+	e := &listEntry{Entry: jlaftp.Entry{Name: line[i+1:]}}
+	var rights string
+	hasRights := false
+	for _, fact := range strings.Split(line[:i], ";") {
+		key, value, ok := strings.Cut(fact, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "type":
+			switch t := strings.ToLower(value); {
+			case t == "file":
+				e.Type = jlaftp.EntryTypeFile
+			case t == "dir":
+				e.Type = jlaftp.EntryTypeFolder
+			case t == "cdir", t == "pdir":
+				return nil, nil
+			case strings.HasPrefix(t, "os.unix=slink"):
+				e.Type = jlaftp.EntryTypeLink
+				if _, target, ok := strings.Cut(value, ":"); ok {
+					e.Target = target
+				}
+			}
+		case "size":
+			size, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, errors.Wrap(err, line)
+			}
+			e.Size = size
+		case "modify":
+			// Fractions of seconds are optional.
+			t, err := time.ParseInLocation("20060102150405", strings.SplitN(value, ".", 2)[0], time.UTC)
+			if err != nil {
+				return nil, errors.Wrap(err, line)
+			}
+			e.Time = t
+		case "unix.mode":
+			// Malformed modes are ignored, as the fact is an extension of some servers.
+			if mode, err := strconv.ParseUint(value, 8, 32); err == nil {
+				e.perm, e.hasPerm = unixMode(mode), true
+			}
+		case "perm":
+			rights, hasRights = strings.ToLower(value), true
+		}
+	}
+	if !e.hasPerm && hasRights {
+		e.perm, e.hasPerm = rightsPerm(e.Type, rights)
+	}
+	return e, nil
+}
+
+// unixMode returns the permission bits of the unix mode, such as 0755 or 04755.
+func unixMode(mode uint64) fs.FileMode {
+	perm := fs.FileMode(mode) & fs.ModePerm
+	for bit, m := range map[uint64]fs.FileMode{04000: fs.ModeSetuid, 02000: fs.ModeSetgid, 01000: fs.ModeSticky} {
+		if mode&bit != 0 {
+			perm |= m
+		}
+	}
+	return perm
+}
+
+// rightsPerm returns the usual permission bits of an entry of type typ, 0644 for a file and 0755 for a directory,
+// without those for reading, writing or entering that rights, the value of a perm fact, does not grant.
+// It reports false for other types, whose rights are not told.
+func rightsPerm(typ jlaftp.EntryType, rights string) (fs.FileMode, bool) {
+	var perm fs.FileMode
+	var read, write, enter string
+	switch typ {
+	case jlaftp.EntryTypeFile:
+		// Files are read with RETR, and written with STOR or APPE.
+		perm, read, write = 0644, "r", "wa"
+	case jlaftp.EntryTypeFolder:
+		// Directories are listed, have files and directories created in them, and are entered with CWD.
+		perm, read, write, enter = 0755, "l", "cm", "e"
+	default:
+		return 0, false
+	}
+	if !strings.ContainsAny(rights, read) {
+		perm &^= 0444
+	}
+	if !strings.ContainsAny(rights, write) {
+		perm &^= 0222
+	}
+	if enter != "" && !strings.ContainsAny(rights, enter) {
+		perm &^= 0111
+	}
+	return perm, true
+}
@@ -0,0 +1,44 @@
+package ftp
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+)
+
+func TestParseMLSD(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		want *listEntry
+	}{
+		{"type=file;size=6;modify=20240102150405; a.txt", &listEntry{Entry: jlaftp.Entry{Name: "a.txt", Type: jlaftp.EntryTypeFile, Size: 6, Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}}},
+		{"Type=dir;Modify=20240102150405.123; my dir", &listEntry{Entry: jlaftp.Entry{Name: "my dir", Type: jlaftp.EntryTypeFolder, Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)}}},
+		{"type=OS.unix=slink:/a.txt; link", &listEntry{Entry: jlaftp.Entry{Name: "link", Type: jlaftp.EntryTypeLink, Target: "/a.txt"}}},
+		{"type=file;size=6;UNIX.mode=0600;UNIX.owner=0; a.txt", &listEntry{Entry: jlaftp.Entry{Name: "a.txt", Type: jlaftp.EntryTypeFile, Size: 6}, perm: 0600, hasPerm: true}},
+		{"type=dir;unix.mode=1777;perm=el; tmp", &listEntry{Entry: jlaftp.Entry{Name: "tmp", Type: jlaftp.EntryTypeFolder}, perm: fs.ModeSticky | 0777, hasPerm: true}},
+		{"type=file;unix.mode=0x1f; odd", &listEntry{Entry: jlaftp.Entry{Name: "odd", Type: jlaftp.EntryTypeFile}}},
+		{"type=file;perm=r; ro.txt", &listEntry{Entry: jlaftp.Entry{Name: "ro.txt", Type: jlaftp.EntryTypeFile}, perm: 0444, hasPerm: true}},
+		{"perm=adfrw;type=file; rw.txt", &listEntry{Entry: jlaftp.Entry{Name: "rw.txt", Type: jlaftp.EntryTypeFile}, perm: 0644, hasPerm: true}},
+		{"type=dir;perm=el; ro", &listEntry{Entry: jlaftp.Entry{Name: "ro", Type: jlaftp.EntryTypeFolder}, perm: 0555, hasPerm: true}},
+		{"type=dir;perm=; none", &listEntry{Entry: jlaftp.Entry{Name: "none", Type: jlaftp.EntryTypeFolder}, perm: 0, hasPerm: true}},
+		{"type=cdir;modify=20240102150405; .", nil},
+		{"Type=cdir;Modify=20240102150405; /tmp", nil},
+		{"Type=cdir; tmp", nil},
+		{"type=pdir; ..", nil},
+	} {
+		got, err := parseMLSD(test.line)
+		if err != nil {
+			t.Errorf("parseMLSD(%q): %v", test.line, err)
+			continue
+		}
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("parseMLSD(%q) = %+v, want %+v", test.line, got, test.want)
+		}
+	}
+
+	if _, err := parseMLSD("type=file;size=6;"); err == nil {
+		t.Errorf("no error for a line without a name")
+	}
+}
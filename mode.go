@@ -0,0 +1,49 @@
+package ftp
+
+import (
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// WithASCII sets whether files are transferred in ASCII mode, with TYPE A, instead of binary mode, with TYPE I.
+// In ASCII mode, the server translates line endings, so that sizes from SIZE and from listings,
+// and the offsets of Seek and ReadAt, may not match the bytes transferred.
+// ASCII mode needs the connections opened by Dial, and otherwise transfers fail with ErrUnsupported.
+// See also FS.ASCII.
+func WithASCII(enabled bool) Option {
+	return func(o *options) {
+		o.ascii = enabled
+	}
+}
+
+// ASCII returns a FS that shares the connections and cache of fsys,
+// and transfers files in ASCII mode if enabled, or in binary mode otherwise, see WithASCII.
+func (fsys *FS) ASCII(enabled bool) *FS {
+	v := *fsys
+	v.opts.ascii = enabled
+	return &v
+}
+
+// setType switches c to the transfer type of fsys, unless it is already set.
+// Login leaves connections in binary mode, and only those opened by Dial can be switched.
+func (fsys *FS) setType(c *jlaftp.ServerConn) error {
+	t := fsys.conns.transport(c)
+	if t == nil {
+		if fsys.opts.ascii {
+			return errors.WithStack(ErrUnsupported)
+		}
+		return nil
+	}
+	if t.ascii == fsys.opts.ascii {
+		return nil
+	}
+	typ := "I"
+	if fsys.opts.ascii {
+		typ = "A"
+	}
+	if _, _, err := command(t.ctrl, jlaftp.StatusCommandOK, "TYPE %s", typ); err != nil {
+		return err
+	}
+	t.ascii = fsys.opts.ascii
+	return nil
+}
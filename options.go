@@ -0,0 +1,237 @@
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"io/fs"
+	"net"
+	"path"
+	"time"
+)
+
+// An Option configures a FS, and how Dial connects to the server.
+type Option func(*options)
+
+type options struct {
+	// Options of Dial.
+	user        string
+	password    string
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	// tlsSessionReuse is set by WithTLSSessionReuse.
+	tlsSessionReuse bool
+	timeout         time.Duration
+	cmdTimeout      time.Duration
+	idleTimeout     time.Duration
+	dialer          func(ctx context.Context, network, addr string) (net.Conn, error)
+	// passiveControlHost is set by WithPassiveControlHost.
+	passiveControlHost bool
+	epsv               bool
+
+	// Options of FS.
+	reconnect    bool
+	logger       Logger
+	drain        bool
+	cacheTTL     time.Duration
+	cacheMax     int
+	symlinkDepth int
+	// dirSymlinkDepth is for listDir, see WithReadDirFollowSymlinks.
+	dirSymlinkDepth int
+	keepAlive       time.Duration
+	progress        func(name string, n int64)
+	metrics         Metrics
+	// retryAttempts is 0 without WithRetry.
+	retryAttempts int
+	retryBackoff  time.Duration
+	retryIf       func(error) bool
+	ascii         bool
+	// caseInsensitive is for getEntry, see WithCaseInsensitive.
+	caseInsensitive bool
+	skipHidden      bool
+	dirFilter       func(fs.DirEntry) bool
+	// dirOrder is for ReadDir if dirOrdered, see WithReadDirOrder.
+	dirOrder   func(a, b fs.DirEntry) bool
+	dirOrdered bool
+	mlsd       bool
+	root       string
+	// drainTimeout bounds finish, see WithDrainTimeout.
+	drainTimeout time.Duration
+	drainBuffer  int
+	rateLimit    int64
+	// seekSkip is the farthest a Seek forward skips within the transfer, see WithSeekSkip.
+	seekSkip  int64
+	charset   Charset
+	readOnly  bool
+	sizeCheck bool
+	// absoluteRoot is set by WithAbsoluteRoot.
+	absoluteRoot bool
+	mkdirParents bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{user: "anonymous", password: "anonymous", reconnect: true, logger: nopLogger{}, drain: true, metrics: nopMetrics{}, retryIf: IsTransient, mlsd: true, epsv: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithReconnect sets whether an operation that finds its connection closed by the server
+// is retried once on a new connection, which is the default, or as set by WithRetry.
+// It applies only to a FS that can dial, such as from Dial or NewPoolFS.
+// Transfers are never retried once data has been exchanged, nor are uploads by Create and Append.
+func WithReconnect(enabled bool) Option {
+	return func(o *options) {
+		o.reconnect = enabled
+	}
+}
+
+// A Logger logs messages, such as a *log.Logger.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, v ...any) {}
+
+// WithLogger logs errors that are not returned to the caller, which are discarded by default.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithDrain sets whether closing a partially read File reads the rest of the file, which is the default.
+// Draining keeps the connection usable, but costs the remaining transfer.
+// Otherwise, the transfer is aborted by closing the data connection,
+// and the control connection, which may be left out of sync, is replaced.
+// A FS from NewFS cannot replace its connection, and always drains.
+func WithDrain(enabled bool) Option {
+	return func(o *options) {
+		o.drain = enabled
+	}
+}
+
+// WithDrainTimeout bounds the time that closing a File takes to drain its transfer, see WithDrain,
+// and to read the reply that ends it, which is unbounded by default.
+// Past d, the transfer is aborted as if draining was disabled, and Close returns os.ErrDeadlineExceeded.
+// The reply is bounded only on connections opened by Dial.
+func WithDrainTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = d
+	}
+}
+
+// WithDrainBuffer sets the size of the buffer that closing a File drains its transfer with, see WithDrain,
+// which is 8 KiB by default, as for io.Discard.
+// A larger buffer drains faster over links with a high latency.
+func WithDrainBuffer(size int) Option {
+	return func(o *options) {
+		o.drainBuffer = size
+	}
+}
+
+// WithSeekSkip sets how far a File may seek forward by reading and discarding the rest of the gap
+// from its transfer in progress, rather than by starting a new one with REST on the next Read.
+// Small skips are cheaper than the round trips and the new data connection of a restart.
+// It is 0 by default, so that every Seek restarts the transfer.
+func WithSeekSkip(n int64) Option {
+	return func(o *options) {
+		o.seekSkip = n
+	}
+}
+
+// WithSizeCheck sets whether Stat and Open log, with the Logger, files whose size in the listing
+// disagrees with the size from SIZE, which is the one they report, see Entry.ListedSize.
+// Sizes are compared on connections in binary mode only, as SIZE may count line endings otherwise.
+func WithSizeCheck(enabled bool) Option {
+	return func(o *options) {
+		o.sizeCheck = enabled
+	}
+}
+
+// WithDirCache caches directory listings for ttl, which serve Open, Stat and ReadDir,
+// along with the sizes from SIZE and the modification times from MDTM.
+// At most max listings or replies are kept, evicting the least recently used, or any number if max <= 0.
+// Writes through the FS invalidate what they affect,
+// but changes made by other clients are seen only after ttl, or after Invalidate.
+func WithDirCache(ttl time.Duration, max int) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+		o.cacheMax = max
+	}
+}
+
+// WithKeepAlive sends NOOP on connections idle for interval, every interval,
+// so that servers with short idle timeouts keep them open.
+// Connections in use are left alone, and a dead one is replaced if the FS can dial.
+// It stops when the FS is closed.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = interval
+	}
+}
+
+// WithCaseInsensitive sets whether names that are not found as is match entries that differ only in case,
+// as on servers with case-insensitive file systems such as Windows.
+// A name matching several entries that way is ambiguous, and fails.
+// Only the last element of a name is matched so, and the commands on it, such as RETR, use the name of the entry it matches.
+// The default is case-sensitive.
+func WithCaseInsensitive(enabled bool) Option {
+	return func(o *options) {
+		o.caseInsensitive = enabled
+	}
+}
+
+// WithSkipHidden sets whether directory listings skip the names beginning with ".",
+// which are still found by Open and Stat.
+func WithSkipHidden(enabled bool) Option {
+	return func(o *options) {
+		o.skipHidden = enabled
+	}
+}
+
+// WithDirFilter keeps only the entries for which keep returns true in directory listings,
+// such as of ReadDir, of a directory File, WalkDir and Glob.
+// The entries filtered out are still found by Open and Stat.
+func WithDirFilter(keep func(fs.DirEntry) bool) Option {
+	return func(o *options) {
+		o.dirFilter = keep
+	}
+}
+
+// WithMkdirParents sets whether WriteFile creates the missing parent directories of a file, as MkdirAll,
+// though with the permissions that the server gives them,
+// when the server fails to store it.
+// It costs nothing while the directories exist.
+func WithMkdirParents(enabled bool) Option {
+	return func(o *options) {
+		o.mkdirParents = enabled
+	}
+}
+
+// WithRoot roots the FS at the server path dir, which is absolute, or relative to the login directory,
+// so that names are joined under dir, as with Sub.
+// Without it, names are sent as is, and so are relative to the login directory, see WithAbsoluteRoot.
+func WithRoot(dir string) Option {
+	return func(o *options) {
+		o.root = path.Clean(dir)
+		if o.root == "." {
+			o.root = ""
+		}
+	}
+}
+
+// WithAbsoluteRoot sets whether the root of the FS, the login directory or the directory of WithRoot,
+// is resolved to an absolute path with PWD once, when the FS is made, so that names are sent to the server as absolute paths,
+// such as "/home/user/dir/file.txt" rather than "dir/file.txt".
+// Servers differ in how they resolve relative paths, and in the working directory they start connections in,
+// so that absolute paths are the more portable, at the cost of a connection when the FS is made.
+// If PWD fails, it is logged, and names remain relative.
+// By default, the root is left as is.
+func WithAbsoluteRoot(enabled bool) Option {
+	return func(o *options) {
+		o.absoluteRoot = enabled
+	}
+}
@@ -0,0 +1,331 @@
+package ftp
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// pingIdle is the idle time after which a pooled connection is checked with NOOP before reuse.
+const pingIdle = 15 * time.Second
+
+// pool is a bounded set of connections to the server.
+// A connection supports only one command or transfer at a time,
+// so it is checked out of the pool for the duration of each operation.
+type pool struct {
+	// dial opens a new connection, and is nil if the pool is fixed to its initial connection.
+	dial func() (*jlaftp.ServerConn, error)
+	// sem holds a token for each connection that is checked out.
+	sem chan struct{}
+	// noSize is set once the server rejects SIZE, to stop sending it.
+	noSize int32
+	// noMLSD is set once the server rejects MLSD, to list with LIST instead.
+	noMLSD int32
+	// listFormat is the format of the last listing on a connection opened by Dial, see ListFormat.
+	listFormat int32
+	// limiter is shared by the transfers of the FS, and is nil without WithRateLimit.
+	limiter *limiter
+
+	mu     sync.Mutex
+	idle   []idleConn
+	closed bool
+	// stop ends keepAlive, and is nil without it.
+	stop chan struct{}
+	// transports are those of the connections opened by Dial.
+	transports map[*jlaftp.ServerConn]*transport
+	// features caches the reply to FEAT, see Features.
+	features map[string]string
+}
+
+type idleConn struct {
+	c     *jlaftp.ServerConn
+	since time.Time
+}
+
+func newPool(dial func() (*jlaftp.ServerConn, error), max int) *pool {
+	if max < 1 {
+		max = 1
+	}
+	return &pool{dial: dial, sem: make(chan struct{}, max)}
+}
+
+// get checks out a connection, waiting until one is free or ctx is done.
+func (p *pool) get(ctx context.Context) (*jlaftp.ServerConn, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	}
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			<-p.sem
+			return nil, errors.New("use of closed FS")
+		}
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		ic := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		// Without dial there is nothing to recycle a dead connection with.
+		if p.dial == nil || time.Since(ic.since) < pingIdle {
+			return ic.c, nil
+		}
+		if err := ic.c.NoOp(); err == nil {
+			return ic.c, nil
+		}
+		p.quit(ic.c)
+	}
+
+	if p.dial == nil {
+		<-p.sem
+		return nil, errors.New("no connection")
+	}
+	c, err := p.dial()
+	if err != nil {
+		<-p.sem
+		return nil, errors.Wrap(err, "")
+	}
+	return c, nil
+}
+
+// put returns a connection from get.
+func (p *pool) put(c *jlaftp.ServerConn) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.quit(c)
+	} else {
+		p.idle = append(p.idle, idleConn{c: c, since: time.Now()})
+		p.mu.Unlock()
+	}
+	<-p.sem
+}
+
+// discard closes a broken connection from get, making room for a new one.
+func (p *pool) discard(c *jlaftp.ServerConn) {
+	p.quit(c)
+	<-p.sem
+}
+
+// close quits idle connections, and connections in use once they are returned.
+func (p *pool) close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	if p.stop != nil && !p.closed {
+		close(p.stop)
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	var firstErr error
+	for _, ic := range idle {
+		if err := p.quit(ic.c); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return errors.Wrap(firstErr, "")
+	}
+	return nil
+}
+
+// keepAlive sends NOOP every interval on the connections idle for as long, until the pool is closed.
+func (p *pool) keepAlive(interval time.Duration, logger Logger) {
+	p.stop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+			p.ping(interval, logger)
+		}
+	}()
+}
+
+// ping sends NOOP on the connections idle for at least d, skipping them if all connections are in use.
+func (p *pool) ping(d time.Duration, logger Logger) {
+	for {
+		select {
+		case p.sem <- struct{}{}:
+		default:
+			return
+		}
+		p.mu.Lock()
+		i := len(p.idle) - 1
+		for i >= 0 && time.Since(p.idle[i].since) < d {
+			i--
+		}
+		if i < 0 {
+			p.mu.Unlock()
+			<-p.sem
+			return
+		}
+		ic := p.idle[i]
+		p.idle = append(p.idle[:i], p.idle[i+1:]...)
+		p.mu.Unlock()
+
+		if err := ic.c.NoOp(); err != nil {
+			logger.Printf("%+v", errors.Wrap(err, "keepalive"))
+			if p.dial != nil {
+				p.discard(ic.c)
+				continue
+			}
+		}
+		// The connection is idle again from now on, so it is not pinged twice.
+		p.put(ic.c)
+	}
+}
+
+// setTransport records the transport of c.
+func (p *pool) setTransport(c *jlaftp.ServerConn, t *transport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transports == nil {
+		p.transports = make(map[*jlaftp.ServerConn]*transport)
+	}
+	p.transports[c] = t
+}
+
+// transport returns the transport of c, or nil if c was not opened by Dial.
+func (p *pool) transport(c *jlaftp.ServerConn) *transport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.transports[c]
+}
+
+// quit sends QUIT and closes c.
+func (p *pool) quit(c *jlaftp.ServerConn) error {
+	p.mu.Lock()
+	delete(p.transports, c)
+	p.mu.Unlock()
+	return c.Quit()
+}
+
+// acquire checks out a connection for exclusive use.
+func (fsys *FS) acquire() (*jlaftp.ServerConn, error) {
+	return fsys.conns.get(fsys.ctx)
+}
+
+// release returns a connection from acquire,
+// discarding it if err shows that it is lost and can be replaced.
+func (fsys *FS) release(c *jlaftp.ServerConn, err error) {
+	if fsys.conns.dial != nil && isConnClosed(err) {
+		fsys.conns.discard(c)
+		return
+	}
+	fsys.conns.put(c)
+}
+
+// hold runs op on a connection, which remains checked out if op succeeds.
+// If op finds the connection lost, it is retried once on a new connection,
+// or as set by WithRetry.
+func (fsys *FS) hold(op func(*jlaftp.ServerConn) error) (*jlaftp.ServerConn, error) {
+	c, err := fsys.acquire()
+	if err != nil {
+		return nil, err
+	}
+	err = fsys.run(c, op)
+	for retries := 0; err != nil; retries++ {
+		wait, ok := fsys.shouldRetry(err, retries)
+		if !ok {
+			break
+		}
+		fsys.release(c, err)
+		if err = fsys.sleep(wait); err != nil {
+			return nil, err
+		}
+		if c, err = fsys.acquire(); err != nil {
+			return nil, err
+		}
+		err = fsys.run(c, op)
+	}
+	if err != nil {
+		fsys.release(c, err)
+		return nil, err
+	}
+	return c, nil
+}
+
+// do runs op on a connection like hold, and then returns the connection.
+func (fsys *FS) do(op func(*jlaftp.ServerConn) error) error {
+	c, err := fsys.hold(op)
+	if err != nil {
+		return err
+	}
+	fsys.release(c, nil)
+	return nil
+}
+
+// finish closes a retrieval held on c, and returns c.
+// eof reports whether resp has been read to the end.
+func (fsys *FS) finish(c *jlaftp.ServerConn, resp *jlaftp.Response, eof bool) error {
+	if !eof && !fsys.opts.drain && fsys.conns.dial != nil {
+		// The server may follow the reply to the aborted transfer with another one,
+		// so the control connection cannot be trusted afterwards.
+		if err := resp.Close(); err != nil {
+			fsys.opts.logger.Printf("%+v", errors.Wrap(err, "abort"))
+		}
+		fsys.conns.discard(c)
+		return nil
+	}
+
+	// clear clears the deadline of the transport, before c is released to other operations.
+	clear := func() {}
+	if d := fsys.opts.drainTimeout; d > 0 {
+		deadline := time.Now().Add(d)
+		if fsys.ctx.Err() != nil {
+			deadline = expired
+		}
+		resp.SetDeadline(deadline)
+		// Bound the wait for the reply that closes the transfer too.
+		if t := fsys.conns.transport(c); t != nil {
+			t.SetDeadline(deadline)
+			clear = func() { t.SetDeadline(time.Time{}) }
+		}
+	}
+
+	// Read to the end because of a bug in jlaffaye/ftp.
+	// https://github.com/jlaffaye/ftp/issues/214.
+	if err := fsys.drain(resp); err != nil {
+		if cerr := resp.Close(); cerr != nil {
+			err = MultiError{errors.Wrap(err, "drain"), errors.Wrap(cerr, "close")}
+		}
+		clear()
+		fsys.release(c, err)
+		return errors.Wrap(err, "")
+	}
+
+	err := resp.Close()
+	clear()
+	fsys.release(c, err)
+	if err != nil {
+		fsys.opts.logger.Printf("%+v", err)
+		return errors.Wrap(err, "")
+	}
+	return nil
+}
+
+// drain reads r to the end, with the buffer set by WithDrainBuffer.
+func (fsys *FS) drain(r io.Reader) error {
+	if fsys.opts.drainBuffer <= 0 {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	}
+	// io.Discard reads with a buffer of its own, unless hidden behind a plain io.Writer.
+	_, err := io.CopyBuffer(struct{ io.Writer }{io.Discard}, r, make([]byte, fsys.opts.drainBuffer))
+	return err
+}
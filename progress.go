@@ -0,0 +1,65 @@
+package ftp
+
+import (
+	"io"
+	"time"
+)
+
+// progressInterval is the least time between two reports of a transfer, besides the final one.
+const progressInterval = 100 * time.Millisecond
+
+// WithProgress calls fn with the bytes read or written so far from the named file,
+// as a File is read or written and when the transfer ends, and as ReadFile reads.
+// Reports are at most every 100ms, except for the last one, which happens on EOF or Close.
+// fn must not call back into the File.
+func WithProgress(fn func(name string, n int64)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// progress throttles the reports of a transfer.
+type progress struct {
+	n        int64
+	reported int64
+	last     time.Time
+}
+
+// add counts n more bytes, and reports the total to fn if the last report is old enough.
+func (p *progress) add(fn func(string, int64), name string, n int) {
+	if fn == nil {
+		return
+	}
+	p.n += int64(n)
+	if p.n != p.reported && time.Since(p.last) >= progressInterval {
+		p.report(fn, name)
+	}
+}
+
+// finish reports the total to fn, unless it was already reported.
+func (p *progress) finish(fn func(string, int64), name string) {
+	if fn == nil || (p.n == p.reported && !p.last.IsZero()) {
+		return
+	}
+	p.report(fn, name)
+}
+
+func (p *progress) report(fn func(string, int64), name string) {
+	p.reported = p.n
+	p.last = time.Now()
+	fn(name, p.n)
+}
+
+// progressWriter counts the bytes written to w.
+type progressWriter struct {
+	w    io.Writer
+	p    *progress
+	fn   func(string, int64)
+	name string
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.add(pw.fn, pw.name, n)
+	return n, err
+}
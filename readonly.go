@@ -0,0 +1,16 @@
+package ftp
+
+import "github.com/pkg/errors"
+
+// ErrReadOnly is for an operation that would modify the server through a read only FS, see WithReadOnly.
+var ErrReadOnly = errors.New("read-only file system")
+
+// WithReadOnly makes the operations that may modify the server fail with ErrReadOnly,
+// without sending any command, as a safety switch against tools that could be destructive.
+// These are Create, Append, OpenFile for writing, WriteFile, CopyFile, Remove, RemoveAll,
+// Mkdir, MkdirAll, Rename, Chtimes, Chmod, Truncate, and Command, which may send anything.
+func WithReadOnly(enabled bool) Option {
+	return func(o *options) {
+		o.readOnly = enabled
+	}
+}
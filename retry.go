@@ -0,0 +1,79 @@
+package ftp
+
+import (
+	"net"
+	"net/textproto"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithRetry tries an operation up to attempts times if it fails with a transient error,
+// waiting backoff before the first retry and doubling the wait after each one.
+// Transient errors are those of IsTransient, unless WithRetryIf is set.
+// As with WithReconnect, a lost connection is replaced only by a FS that can dial,
+// and transfers are not retried once data has been exchanged, nor are uploads by Create and Append.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.retryAttempts = attempts
+		o.retryBackoff = backoff
+	}
+}
+
+// WithRetryIf sets the function deciding whether an error is transient for WithRetry.
+// fn is called with the error of the failed command, before it is translated into an io/fs error.
+func WithRetryIf(fn func(err error) bool) Option {
+	return func(o *options) {
+		o.retryIf = fn
+	}
+}
+
+// IsTransient reports whether err is likely to go away when the operation is retried,
+// which is the case of a lost or timed out connection, of a data connection that could not be opened,
+// and of a reply with a 4xx code such as 421, 425, 426 or 450, that FTP defines as transient.
+// Permanent replies such as 550 are not transient.
+func IsTransient(err error) bool {
+	if isConnClosed(err) {
+		return true
+	}
+	var op *net.OpError
+	if errors.As(err, &op) && op.Op == "dial" {
+		return true
+	}
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 400 && reply.Code < 500
+}
+
+// shouldRetry reports whether an operation that failed with err after the given number of retries is retried,
+// and after how long.
+func (fsys *FS) shouldRetry(err error, retries int) (time.Duration, bool) {
+	if fsys.ctx.Err() != nil {
+		return 0, false
+	}
+	if isConnClosed(err) && (!fsys.opts.reconnect || fsys.conns.dial == nil) {
+		return 0, false
+	}
+	if fsys.opts.retryAttempts <= 0 {
+		// Without a retry policy, only a lost connection is replaced, once.
+		return 0, retries == 0 && isConnClosed(err)
+	}
+	if retries+1 >= fsys.opts.retryAttempts || !fsys.opts.retryIf(err) {
+		return 0, false
+	}
+	return fsys.opts.retryBackoff << retries, true
+}
+
+// sleep waits for d, or until the context of fsys is done.
+func (fsys *FS) sleep(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-fsys.ctx.Done():
+		return errors.WithStack(fsys.ctx.Err())
+	}
+}
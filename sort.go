@@ -0,0 +1,65 @@
+package ftp
+
+import (
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// WithReadDirOrder sorts the entries returned by FS.ReadDir with less, such as ByModTime,
+// or leaves them in the order of the server if less is nil.
+// Other listings, such as of a directory File, WalkDir and fs.ReadDir through Open,
+// are always sorted by name, as io/fs requires.
+func WithReadDirOrder(less func(a, b fs.DirEntry) bool) Option {
+	return func(o *options) {
+		o.dirOrder = less
+		o.dirOrdered = true
+	}
+}
+
+// ByName orders entries by name, which is the default of ReadDir.
+func ByName(a, b fs.DirEntry) bool {
+	return a.Name() < b.Name()
+}
+
+// ByModTime orders entries from the oldest to the newest.
+func ByModTime(a, b fs.DirEntry) bool {
+	return entryModTime(a).Before(entryModTime(b))
+}
+
+// BySize orders entries from the smallest to the largest.
+func BySize(a, b fs.DirEntry) bool {
+	return entrySize(a) < entrySize(b)
+}
+
+func entryModTime(d fs.DirEntry) time.Time {
+	info, err := d.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func entrySize(d fs.DirEntry) int64 {
+	info, err := d.Info()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// readDirOrdered lists a directory for ReadDir, in the order set by WithReadDirOrder.
+// Entries that are equal for the order keep the order of the server.
+func (fsys *FS) readDirOrdered(name string) ([]fs.DirEntry, error) {
+	if !fsys.opts.dirOrdered {
+		return fsys.readDir(name)
+	}
+	ds, err := fsys.listDir(name)
+	if err != nil {
+		return nil, err
+	}
+	if less := fsys.opts.dirOrder; less != nil {
+		sort.SliceStable(ds, func(i, j int) bool { return less(ds[i], ds[j]) })
+	}
+	return ds, nil
+}
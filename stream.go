@@ -0,0 +1,136 @@
+package ftp
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"sync/atomic"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// maxMLSDLine bounds the length of a line of a MLSD listing.
+const maxMLSDLine = 1 << 20
+
+// ReadDirFunc calls fn with each entry of the named directory, in the order of the server,
+// and stops at the first error of fn, which it returns.
+// On connections opened by Dial to servers that support MLSD, entries are parsed as they arrive,
+// so that the listing of a huge directory is never held in memory.
+// Otherwise, the listing is read first, as by ReadDir.
+// The directory cache is not used, but WithSkipHidden and WithDirFilter apply.
+// fn must not use the FS if it has a single connection, as from NewFS or Dial.
+func (fsys *FS) ReadDirFunc(name string, fn func(fs.DirEntry) error) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	var fnErr error
+	yield := func(e *listEntry) bool {
+		fsys.listed(e)
+		if d, ok := fsys.dirEntry(e); ok {
+			fnErr = fn(d)
+		}
+		return fnErr == nil
+	}
+	dir := fsys.serverPath(name)
+	// Not retried, as fn may have seen some of the entries.
+	c, err := fsys.acquire()
+	if err != nil {
+		return &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	err = fsys.run(c, func(c *jlaftp.ServerConn) error {
+		err := fsys.streamMLSD(c, dir, yield)
+		if !errors.Is(mapErr(err), ErrUnsupported) {
+			return err
+		}
+		entries, err := fsys.listLIST(c, dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !yield(e) {
+				break
+			}
+		}
+		return nil
+	})
+	fsys.release(c, err)
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return &fs.PathError{Op: "readdir", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	return nil
+}
+
+// streamMLSD lists dir with MLSD on c, calling yield with each entry until it returns false.
+// It fails with ErrUnsupported if c was not opened by Dial, or if MLSD is disabled or rejected, see WithMLSD.
+// The rest of the listing after yield returns false is read and discarded, which keeps c in sync.
+func (fsys *FS) streamMLSD(c *jlaftp.ServerConn, dir string, yield func(*listEntry) bool) (err error) {
+	t := fsys.conns.transport(c)
+	if t == nil || !fsys.opts.mlsd || atomic.LoadInt32(&fsys.conns.noMLSD) != 0 {
+		return errors.WithStack(ErrUnsupported)
+	}
+	start := time.Now()
+	defer func() { fsys.observeCommand("MLSD", start, err) }()
+	conn, err := t.passive()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, _, err := command(t.ctrl, 1, "MLSD %s", dir); err != nil {
+		if errors.Is(mapErr(err), ErrUnsupported) {
+			atomic.StoreInt32(&fsys.conns.noMLSD, 1)
+		}
+		return err
+	}
+
+	var parseErr error
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 4096), maxMLSDLine)
+	for sc.Scan() {
+		if parseErr != nil {
+			continue
+		}
+		e, err := parseMLSD(sc.Text())
+		if err != nil {
+			parseErr = err
+			continue
+		}
+		if e == nil {
+			continue
+		}
+		if !yield(e) {
+			// Drain, so that the server completes the transfer.
+			io.Copy(io.Discard, conn)
+			break
+		}
+	}
+	conn.Close()
+	// Read the reply to the transfer even if it failed, to keep c in sync.
+	_, _, err = readReply(t.ctrl, 2)
+	if serr := sc.Err(); serr != nil {
+		return serr
+	}
+	if err != nil {
+		return err
+	}
+	return parseErr
+}
+
+// listLIST lists dir with LIST on c, whose listing jlaffaye/ftp parses.
+func (fsys *FS) listLIST(c *jlaftp.ServerConn, dir string) ([]*listEntry, error) {
+	start := time.Now()
+	entries, err := c.List(dir)
+	fsys.observeCommand("LIST", start, err)
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]*listEntry, len(entries))
+	for i, e := range entries {
+		listed[i] = &listEntry{Entry: *e}
+	}
+	return listed, nil
+}
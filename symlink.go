@@ -0,0 +1,149 @@
+package ftp
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// maxSymlinks bounds the symlinks followed by EvalSymlinks, as in Linux.
+const maxSymlinks = 40
+
+// ErrSymlinkLoop is for a symlink that leads back to itself, or through more symlinks in a row than followed.
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// WithFollowSymlinks makes Open and Stat follow a symlink to its target, up to depth links in a row.
+// By default, symlinks are not followed, and opening one leaves it to the server to resolve.
+// Links in the directories of a name are always resolved by the server.
+func WithFollowSymlinks(depth int) Option {
+	return func(o *options) {
+		o.symlinkDepth = depth
+	}
+}
+
+// WithReadDirFollowSymlinks makes directory listings, such as of ReadDir, WalkDir and Glob,
+// report the symlinks that lead to a file or a directory within depth links in a row as their targets, under their own names,
+// so that walks descend into linked directories. Each symlink costs the listing of the directory of its target.
+// Other symlinks, such as dangling ones, are still reported with fs.ModeSymlink, as they are by default.
+// WalkDir and WalkConcurrent do not descend into a linked directory that contains a directory being walked,
+// such as a link to an ancestor, which fails to be read with ErrSymlinkLoop instead, whereas fs.WalkDir does.
+// ReadDirFunc reports symlinks as listed.
+func WithReadDirFollowSymlinks(depth int) Option {
+	return func(o *options) {
+		o.dirSymlinkDepth = depth
+	}
+}
+
+// linkedEntry returns the entry of the target of the symlink e, listed in the directory dir, under the name of e,
+// or e itself if the target cannot be resolved, see WithReadDirFollowSymlinks.
+func (fsys *FS) linkedEntry(dir string, e *listEntry) *listEntry {
+	name, target, err := fsys.resolve(path.Join(dir, e.Name), fsys.opts.dirSymlinkDepth)
+	if err != nil || target.Type == jlaftp.EntryTypeLink {
+		return e
+	}
+	t := *target
+	t.Name = e.Name
+	t.linked = name
+	return &t
+}
+
+// ReadLink returns the target of the named symlink, as shown by the LIST command.
+// Servers listing with MLSD do not report symlinks.
+func (fsys *FS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, err := fsys.getEntry(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if entry.Type != jlaftp.EntryTypeLink {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	if entry.Target == "" {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.New("unknown target")}
+	}
+	return entry.Target, nil
+}
+
+// EvalSymlinks returns the name that the named file resolves to, after following symlinks.
+// Targets must be within the file system.
+func (fsys *FS) EvalSymlinks(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: fs.ErrInvalid}
+	}
+	depth := fsys.opts.symlinkDepth
+	if depth <= 0 {
+		depth = maxSymlinks
+	}
+	target, _, err := fsys.resolve(name, depth)
+	if err != nil {
+		return "", &fs.PathError{Op: "evalsymlinks", Path: name, Err: err}
+	}
+	return target, nil
+}
+
+// resolve returns the entry of name and the name it resolves to, following up to depth symlinks.
+// A symlink seen twice is a loop, which fails without following the rest of the depth.
+func (fsys *FS) resolve(name string, depth int) (string, *listEntry, error) {
+	var seen map[string]bool
+	for i := 0; ; i++ {
+		entry, err := fsys.getEntry(name)
+		if err != nil {
+			return "", nil, err
+		}
+		if fsys.opts.caseInsensitive && name != "." && entry.Name != path.Base(name) {
+			// The commands on the entry use the name as listed, see WithCaseInsensitive.
+			name = path.Join(path.Dir(name), entry.Name)
+		}
+		if entry.Type != jlaftp.EntryTypeLink || depth <= 0 {
+			return name, entry, nil
+		}
+		if i == depth {
+			return "", nil, errors.WithStack(ErrSymlinkLoop)
+		}
+		if seen == nil {
+			seen = make(map[string]bool)
+		}
+		seen[name] = true
+		if name, err = fsys.linkTarget(name, entry.Target); err != nil {
+			return "", nil, err
+		}
+		if seen[name] {
+			return "", nil, errors.Wrap(ErrSymlinkLoop, name)
+		}
+	}
+}
+
+// linkTarget returns the name of the target of the symlink name.
+func (fsys *FS) linkTarget(name, target string) (string, error) {
+	if target == "" {
+		return "", errors.Errorf("unknown target of %s", name)
+	}
+	if !path.IsAbs(target) {
+		rel := path.Join(path.Dir(name), target)
+		if !fs.ValidPath(rel) {
+			return "", errors.Errorf("target %s of %s is outside the file system", target, name)
+		}
+		return rel, nil
+	}
+
+	// Absolute targets are relative to the server root, rather than to the login directory.
+	root, err := fsys.Getwd()
+	if err != nil {
+		return "", err
+	}
+	target = path.Clean(target)
+	switch {
+	case target == root:
+		return ".", nil
+	case root == "/":
+		return target[1:], nil
+	case strings.HasPrefix(target, root+"/"):
+		return target[len(root)+1:], nil
+	}
+	return "", errors.Errorf("target %s of %s is outside the file system", target, name)
+}
@@ -0,0 +1,35 @@
+package ftp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithTracing returns a FS that shares the connections and cache of fsys,
+// and writes a line to w for each of its operations, and those of its Files, with the name, duration and result,
+// such as "stat d/b.txt 1.2ms ok", to debug a misbehaving server.
+// The operations are those reported to Metrics, and behave as those of fsys.
+// Writes to w are serialized, and their errors are ignored.
+func WithTracing(fsys *FS, w io.Writer) *FS {
+	v := *fsys
+	v.trace = &tracer{w: w}
+	return &v
+}
+
+// tracer writes the lines of WithTracing.
+type tracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (t *tracer) printf(op, name string, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = err.Error()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "%s %s %v %s\n", op, name, d, result)
+}
@@ -0,0 +1,318 @@
+package ftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// transport opens the connections of a ServerConn for Dial.
+// It owns the control connection, on which commands that jlaffaye/ftp lacks are sent,
+// and handles TLS itself, explicit or implicit, so that these commands are also encrypted.
+type transport struct {
+	ctx  context.Context
+	o    options
+	host string
+	// tlsConfig is o.tlsConfig with a ServerName, or nil without TLS.
+	tlsConfig *tls.Config
+
+	// ctrl is the control connection, and is nil until it is dialed.
+	// Later dials are for data connections.
+	ctrl net.Conn
+	// unwatch stops the interruption of the control connection by ctx, once logged in, see dial.
+	unwatch func()
+
+	// deadline applies to the data connections opened until it is cleared, which are in data.
+	mu       sync.Mutex
+	deadline time.Time
+	data     []net.Conn
+
+	// ascii is whether the connection is in ASCII mode, see FS.setType.
+	// It is accessed only while the connection is checked out.
+	ascii bool
+}
+
+func newTransport(ctx context.Context, addr string, o options) *transport {
+	t := &transport{ctx: ctx, o: o}
+	t.host, _, _ = net.SplitHostPort(addr)
+	if o.tlsConfig != nil {
+		t.tlsConfig = o.tlsConfig.Clone()
+		if t.tlsConfig.ServerName == "" {
+			t.tlsConfig.ServerName = t.host
+		}
+		if o.tlsSessionReuse {
+			// Sessions are cached by server name, which is the same for the control and data connections.
+			t.tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+		}
+	}
+	return t
+}
+
+// dial is a jlaftp.DialWithDialFunc.
+func (t *transport) dial(network, addr string) (net.Conn, error) {
+	if t.ctrl != nil {
+		// jlaffaye/ftp opens EPSV data connections to the remote host of the control connection,
+		// which is the proxy rather than the server with WithDialer.
+		if host, port, err := net.SplitHostPort(addr); err == nil && (t.o.passiveControlHost || t.o.dialer != nil && host == t.remoteHost()) {
+			addr = net.JoinHostPort(t.host, port)
+		}
+		conn, err := t.connect(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if t.o.idleTimeout > 0 {
+			conn = &timeoutConn{Conn: conn, timeout: t.o.idleTimeout}
+		}
+		if t.tlsConfig != nil {
+			conn = tls.Client(conn, t.tlsConfig)
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if !t.deadline.IsZero() {
+			conn.SetDeadline(t.deadline)
+			t.data = append(t.data, conn)
+		}
+		return conn, nil
+	}
+
+	conn, err := t.connect(t.ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if t.o.cmdTimeout > 0 {
+		conn = &timeoutConn{Conn: conn, timeout: t.o.cmdTimeout}
+	}
+	// The greeting and the login are read by jlaffaye/ftp, through the deadline of conn,
+	// which is set on the timeoutConn so that the deadline of each Read and Write keeps to it.
+	t.unwatch = watch(t.ctx, conn)
+	if t.tlsConfig == nil {
+		t.ctrl = conn
+		return conn, nil
+	}
+	if t.o.implicitTLS {
+		tconn := tls.Client(conn, t.tlsConfig)
+		if err := tconn.HandshakeContext(t.ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		t.ctrl = tconn
+		return tconn, nil
+	}
+	c, err := t.authTLS(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// remoteHost returns the host of the remote address of the control connection, or "" if it has none.
+func (t *transport) remoteHost() string {
+	addr := t.ctrl.RemoteAddr()
+	if addr == nil {
+		return ""
+	}
+	host, _, _ := net.SplitHostPort(addr.String())
+	return host
+}
+
+// connect opens a TCP connection to addr, with the dialer of WithDialer if set, bounded by WithTimeout.
+func (t *transport) connect(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t.o.dialer == nil {
+		d := net.Dialer{Timeout: t.o.timeout}
+		return d.DialContext(ctx, network, addr)
+	}
+	if t.o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.o.timeout)
+		defer cancel()
+	}
+	return t.o.dialer(ctx, network, addr)
+}
+
+// passive opens a data connection in passive mode, with EPSV or else PASV, as jlaffaye/ftp does, see WithEPSV.
+// EPSV data connections are to the remote host of the control connection, as with jlaffaye/ftp,
+// rather than to the host that Dial was given, which may resolve to other addresses.
+// With WithDialer, whose remote host may be a proxy, dial replaces it with the host that Dial was given.
+func (t *transport) passive() (net.Conn, error) {
+	host := t.remoteHost()
+	if host == "" {
+		host = t.host
+	}
+	var port int
+	var msg string
+	var err error
+	if t.o.epsv {
+		_, msg, err = command(t.ctrl, jlaftp.StatusExtendedPassiveMode, "EPSV")
+	}
+	if t.o.epsv && err == nil {
+		// The reply is like "Entering Extended Passive Mode (|||6446|)".
+		start, end := strings.Index(msg, "|||"), strings.LastIndex(msg, "|")
+		if start < 0 || end <= start+3 {
+			return nil, errors.Errorf("invalid EPSV reply %q", msg)
+		}
+		if port, err = strconv.Atoi(msg[start+3 : end]); err != nil {
+			return nil, errors.Wrap(err, msg)
+		}
+	} else {
+		if _, msg, err = command(t.ctrl, jlaftp.StatusPassiveMode, "PASV"); err != nil {
+			return nil, err
+		}
+		// The reply is like "Entering Passive Mode (h1,h2,h3,h4,p1,p2)".
+		start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if start < 0 || end <= start {
+			return nil, errors.Errorf("invalid PASV reply %q", msg)
+		}
+		fields := strings.Split(msg[start+1:end], ",")
+		if len(fields) != 6 {
+			return nil, errors.Errorf("invalid PASV reply %q", msg)
+		}
+		var ns [6]int
+		for i, f := range fields {
+			if ns[i], err = strconv.Atoi(strings.TrimSpace(f)); err != nil {
+				return nil, errors.Wrap(err, msg)
+			}
+		}
+		host = fmt.Sprintf("%d.%d.%d.%d", ns[0], ns[1], ns[2], ns[3])
+		port = ns[4]<<8 | ns[5]
+	}
+	return t.dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// authTLS upgrades conn with AUTH TLS, and returns it to replay the greeting of the server to jlaffaye/ftp.
+func (t *transport) authTLS(conn net.Conn) (net.Conn, error) {
+	var greeting bytes.Buffer
+	if _, _, err := readReply(io.TeeReader(conn, &greeting), jlaftp.StatusReady); err != nil {
+		return nil, err
+	}
+	if _, _, err := command(conn, jlaftp.StatusAuthOK, "AUTH TLS"); err != nil {
+		return nil, err
+	}
+	tconn := tls.Client(conn, t.tlsConfig)
+	if err := tconn.HandshakeContext(t.ctx); err != nil {
+		return nil, err
+	}
+	t.ctrl = tconn
+	return &replayConn{Conn: tconn, pending: greeting.Bytes()}, nil
+}
+
+// SetDeadline sets the deadline of the control connection,
+// and of the data connections opened until the deadline is cleared with a zero value.
+func (t *transport) SetDeadline(d time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.deadline = d
+	for _, conn := range t.data {
+		conn.SetDeadline(d)
+	}
+	if d.IsZero() {
+		t.data = nil
+	}
+	return t.ctrl.SetDeadline(d)
+}
+
+// timeoutConn bounds each Read and Write by timeout, besides the deadline that is set.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+
+	// mu orders the deadline of each Read and Write with SetDeadline.
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *timeoutConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *timeoutConn) Read(b []byte) (int, error) {
+	if err := c.next(c.Conn.SetReadDeadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *timeoutConn) Write(b []byte) (int, error) {
+	if err := c.next(c.Conn.SetWriteDeadline); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// next sets the deadline of the next Read or Write with set.
+func (c *timeoutConn) next(set func(time.Time) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d := time.Now().Add(c.timeout)
+	if !c.deadline.IsZero() && c.deadline.Before(d) {
+		d = c.deadline
+	}
+	return set(d)
+}
+
+// replayConn reads pending before the rest of the connection.
+type replayConn struct {
+	net.Conn
+	pending []byte
+}
+
+func (c *replayConn) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// command sends a command on the control connection conn, and reads the reply.
+// An expected code <= 0 accepts any reply.
+func command(conn net.Conn, expected int, format string, args ...any) (int, string, error) {
+	if _, err := fmt.Fprintf(conn, format+"\r\n", args...); err != nil {
+		return 0, "", err
+	}
+	return readReply(conn, expected)
+}
+
+// readReply reads a reply from r without reading past it,
+// as the rest of the stream belongs to jlaffaye/ftp.
+func readReply(r io.Reader, expected int) (int, string, error) {
+	return textproto.NewReader(bufio.NewReaderSize(byteReader{r}, 16)).ReadResponse(expected)
+}
+
+// byteReader reads one byte at a time.
+type byteReader struct {
+	r io.Reader
+}
+
+func (b byteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return b.r.Read(p)
+}
+
+// command sends a command that jlaffaye/ftp lacks on c, which must be checked out.
+// It fails with ErrUnsupported if c was not opened by Dial.
+func (fsys *FS) command(c *jlaftp.ServerConn, expected int, format string, args ...any) (int, string, error) {
+	t := fsys.conns.transport(c)
+	if t == nil {
+		return 0, "", errors.WithStack(ErrUnsupported)
+	}
+	return command(t.ctrl, expected, format, args...)
+}
@@ -0,0 +1,230 @@
+package ftp
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// WalkDir walks the file tree rooted at root as fs.WalkDir, listing each directory once.
+// Entries are from the listings, so their Info needs no further command,
+// and unlike with fs.Stat, the root costs no SIZE command.
+// Only the root is followed if it is a symlink, see WithFollowSymlinks, and symlinks below it are not,
+// unless WithReadDirFollowSymlinks is set, with which linked directories that contain a directory being walked,
+// such as links to ancestors, fail with ErrSymlinkLoop, as directories that cannot be read.
+// A root that loops fails with ErrSymlinkLoop too.
+func WalkDir(fsys *FS, root string, fn fs.WalkDirFunc) error {
+	return walk(fsys, root, fsys.readDir, fn)
+}
+
+// WalkConcurrent walks the file tree rooted at root as WalkDir,
+// while up to workers directories are listed concurrently, over connections of the pool of fsys, see NewPoolFS.
+// fn is called from a single goroutine, on the same entries, in the same order and with the same errors as by WalkDir,
+// and only the listings run ahead of it: the subdirectories of a directory are queued for listing
+// as soon as it is listed, even if fn then skips some of them with fs.SkipDir.
+func WalkConcurrent(fsys *FS, root string, workers int, fn fs.WalkDirFunc) error {
+	if workers <= 1 {
+		return WalkDir(fsys, root, fn)
+	}
+	l := &lister{fsys: fsys, pending: make(map[string]*listing)}
+	l.cond = sync.NewCond(&l.mu)
+	for i := 0; i < workers; i++ {
+		go l.work()
+	}
+	defer l.stop()
+	return walk(fsys, root, l.readDir, fn)
+}
+
+func walk(fsys *FS, root string, readDir func(string) ([]fs.DirEntry, error), fn fs.WalkDirFunc) error {
+	var err error
+	if !fs.ValidPath(root) {
+		err = fn(root, nil, &fs.PathError{Op: "stat", Path: root, Err: fs.ErrInvalid})
+	} else if target, entry, rerr := fsys.resolve(root, fsys.opts.symlinkDepth); rerr != nil {
+		err = fn(root, nil, &fs.PathError{Op: "stat", Path: root, Err: rerr})
+	} else {
+		info := fileinfo{e: *entry}
+		info.e.Name = path.Base(root)
+		w := &walker{readDir: readDir, fn: fn}
+		err = w.walkDir(root, target, fs.FileInfoToDirEntry(info))
+	}
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walker walks a file tree for walk.
+type walker struct {
+	readDir func(string) ([]fs.DirEntry, error)
+	fn      fs.WalkDirFunc
+	// ancestors are the resolved names of the directories being walked, from the root.
+	ancestors []string
+}
+
+// walkDir walks the directory name, which resolves to resolved, as the walkDir of io/fs.
+func (w *walker) walkDir(name, resolved string, d fs.DirEntry) error {
+	if err := w.fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return err
+	}
+
+	var dirs []fs.DirEntry
+	var err error
+	if linkedName(d) != "" && w.loops(resolved) {
+		err = errors.Wrap(ErrSymlinkLoop, resolved)
+	} else {
+		dirs, err = w.readDir(name)
+	}
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = w.fn(name, d, &fs.PathError{Op: "readdir", Path: name, Err: err})
+		if err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	w.ancestors = append(w.ancestors, resolved)
+	defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+	for _, d1 := range dirs {
+		resolved1 := linkedName(d1)
+		if resolved1 == "" {
+			resolved1 = path.Join(resolved, d1.Name())
+		}
+		if err := w.walkDir(path.Join(name, d1.Name()), resolved1, d1); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// loops reports whether the directory resolved contains one of the ancestors, so that walking it would not end.
+func (w *walker) loops(resolved string) bool {
+	for _, a := range w.ancestors {
+		if resolved == "." || a == resolved || strings.HasPrefix(a, resolved+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// linkedName returns the name of the target of the symlink that d is listed as, or "" if d is not, see linkedEntry.
+func linkedName(d fs.DirEntry) string {
+	info, err := d.Info()
+	if err != nil {
+		return ""
+	}
+	if info, ok := info.(fileinfo); ok {
+		return info.e.linked
+	}
+	return ""
+}
+
+// lister lists directories ahead of WalkConcurrent.
+type lister struct {
+	fsys *FS
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds the directories to list, in the order of the walk.
+	queue   []listJob
+	pending map[string]*listing
+	stopped bool
+}
+
+type listJob struct {
+	name string
+	l    *listing
+}
+
+// listing is the result of listing a directory, once done is closed.
+type listing struct {
+	done chan struct{}
+	dirs []fs.DirEntry
+	err  error
+}
+
+// readDir returns the listing of name, and queues those of its subdirectories.
+func (l *lister) readDir(name string) ([]fs.DirEntry, error) {
+	l.mu.Lock()
+	li := l.pending[name]
+	delete(l.pending, name)
+	if li == nil {
+		li = &listing{done: make(chan struct{})}
+		l.queue = append([]listJob{{name: name, l: li}}, l.queue...)
+	} else {
+		l.promote(name)
+	}
+	l.mu.Unlock()
+	l.cond.Signal()
+	<-li.done
+	if li.err != nil {
+		return nil, li.err
+	}
+
+	// The walk goes depth first, so the subdirectories go before the siblings of name.
+	var jobs []listJob
+	l.mu.Lock()
+	for _, d := range li.dirs {
+		if d.IsDir() {
+			job := listJob{name: path.Join(name, d.Name()), l: &listing{done: make(chan struct{})}}
+			l.pending[job.name] = job.l
+			jobs = append(jobs, job)
+		}
+	}
+	l.queue = append(jobs, l.queue...)
+	l.mu.Unlock()
+	l.cond.Broadcast()
+	return li.dirs, nil
+}
+
+// promote moves the job of name, if it is still queued, to the front of the queue, ahead of directories
+// that the walk skipped, and must be called with mu held.
+func (l *lister) promote(name string) {
+	for i, job := range l.queue {
+		if job.name == name {
+			copy(l.queue[1:i+1], l.queue[:i])
+			l.queue[0] = job
+			return
+		}
+	}
+}
+
+// work lists the queued directories until stop.
+func (l *lister) work() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		for len(l.queue) == 0 && !l.stopped {
+			l.cond.Wait()
+		}
+		if l.stopped {
+			return
+		}
+		job := l.queue[0]
+		l.queue = l.queue[1:]
+		l.mu.Unlock()
+		job.l.dirs, job.l.err = l.fsys.readDir(job.name)
+		close(job.l.done)
+		l.mu.Lock()
+	}
+}
+
+// stop ends the workers once they are done with their current listings.
+func (l *lister) stop() {
+	l.mu.Lock()
+	l.stopped = true
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
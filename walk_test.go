@@ -0,0 +1,54 @@
+package ftp_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fumin/ftp"
+)
+
+func TestWalkDirSymlinkLoop(t *testing.T) {
+	files := fstest.MapFS{
+		"d/e/c.txt": {Data: []byte("c")},
+		"d/e/up":    {Data: []byte("../.."), Mode: fs.ModeSymlink},
+		"d/side":    {Data: []byte("../x"), Mode: fs.ModeSymlink},
+		"x/f.txt":   {Data: []byte("f")},
+	}
+	if _, ok := fs.FS(files).(interface{ ReadLink(string) (string, error) }); !ok {
+		t.Skip("fstest.MapFS does not read symlinks before Go 1.25")
+	}
+	fsys := dial(t, newServer(t, files), ftp.WithReadDirFollowSymlinks(8))
+
+	err := ftp.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		return err
+	})
+	if !errors.Is(err, ftp.ErrSymlinkLoop) {
+		t.Errorf("WalkDir = %v, want %v", err, ftp.ErrSymlinkLoop)
+	}
+
+	var walked, failed []string
+	err = ftp.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if !errors.Is(err, ftp.ErrSymlinkLoop) {
+				return err
+			}
+			failed = append(failed, name)
+			return nil
+		}
+		walked = append(walked, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The link to a sibling is walked, unlike that to an ancestor.
+	if got, want := strings.Join(walked, " "), ". d d/e d/e/c.txt d/e/up d/side d/side/f.txt x x/f.txt"; got != want {
+		t.Errorf("walked %q, want %q", got, want)
+	}
+	if got, want := strings.Join(failed, " "), "d/e/up"; got != want {
+		t.Errorf("loops at %q, want %q", got, want)
+	}
+}
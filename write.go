@@ -0,0 +1,343 @@
+package ftp
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	jlaftp "github.com/jlaffaye/ftp"
+	"github.com/pkg/errors"
+)
+
+// Remove removes the named file with DELE, or the named empty directory with RMD.
+func (fsys *FS) Remove(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+	}
+	entry, err := fsys.getEntry(name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if err := fsys.remove(name, entry.Type == jlaftp.EntryTypeFolder); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+// RemoveAll removes name and any children it contains, and is a no-op if name does not exist.
+// Symlinks are removed rather than followed.
+func (fsys *FS) RemoveAll(name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+	}
+	entry, err := fsys.getEntry(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if err := fsys.removeAll(name, entry.Type == jlaftp.EntryTypeFolder); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (fsys *FS) removeAll(name string, dir bool) error {
+	if dir {
+		// Hidden and filtered out entries are removed too, see WithDirFilter.
+		entries, err := fsys.list(fsys.serverPath(name))
+		if err != nil {
+			return errors.WithStack(mapErr(err))
+		}
+		for _, e := range entries {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			child := path.Join(name, e.Name)
+			if err := fsys.removeAll(child, e.Type == jlaftp.EntryTypeFolder); err != nil {
+				return errors.Wrap(err, child)
+			}
+		}
+	}
+	return fsys.remove(name, dir)
+}
+
+func (fsys *FS) remove(name string, dir bool) error {
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		if dir {
+			return c.RemoveDir(fsys.serverPath(name))
+		}
+		return c.Delete(fsys.serverPath(name))
+	})
+	fsys.Invalidate(name)
+	if err != nil {
+		return errors.WithStack(mapErr(err))
+	}
+	return nil
+}
+
+// Mkdir creates the named directory with MKD.
+// It fails with fs.ErrExist if name already exists.
+// perm is then set with SITE CHMOD, see Chmod, unless the server does not implement it,
+// or fsys was not opened by Dial, which leaves the directory with the permissions that the server gives it.
+func (fsys *FS) Mkdir(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+	}
+	if err := fsys.mkdir(name); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return fsys.setPerm(name, perm)
+}
+
+// MkdirAll creates the named directory along with any missing parents,
+// and is a no-op if name is already a directory.
+// perm is set on the directories it creates, as by Mkdir.
+func (fsys *FS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: ErrReadOnly}
+	}
+	err := fsys.mkdirAll(name, func(dir string) error {
+		return fsys.setPerm(dir, perm)
+	})
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// mkdirAll creates name along with its missing parents, calling made, if not nil, with each directory it creates.
+func (fsys *FS) mkdirAll(name string, made func(dir string) error) error {
+	entry, err := fsys.getEntry(name)
+	if err == nil {
+		if entry.Type == jlaftp.EntryTypeFolder {
+			return nil
+		}
+		return errors.New("not a directory")
+	}
+	if parent := path.Dir(name); parent != "." {
+		if err := fsys.mkdirAll(parent, made); err != nil {
+			return err
+		}
+	}
+	err = fsys.mkdir(name)
+	if errors.Is(err, fs.ErrExist) {
+		// Created concurrently, unless it is a file.
+		if entry, err := fsys.getEntry(name); err == nil && entry.Type == jlaftp.EntryTypeFolder {
+			return nil
+		}
+	}
+	if err == nil && made != nil {
+		return made(name)
+	}
+	return err
+}
+
+// setPerm sets the permission bits of the directory name, just created, to those of perm,
+// unless the server or the connection cannot, see Mkdir.
+func (fsys *FS) setPerm(name string, perm fs.FileMode) error {
+	if err := fsys.Chmod(name, perm); err != nil && !errors.Is(err, ErrUnsupported) {
+		return err
+	}
+	return nil
+}
+
+func (fsys *FS) mkdir(name string) error {
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		return c.MakeDir(fsys.serverPath(name))
+	})
+	fsys.Invalidate(name)
+	if err == nil {
+		return nil
+	}
+	// Servers reply 550 both for an existing name and a missing parent.
+	if _, serr := fsys.getEntry(name); serr == nil {
+		return errors.Wrap(fs.ErrExist, err.Error())
+	}
+	return errors.WithStack(mapErr(err))
+}
+
+// Rename renames oldname to newname with RNFR and RNTO, which may move it to another directory.
+// Whether an existing newname is replaced depends on the server.
+func (fsys *FS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrReadOnly}
+	}
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		return c.Rename(fsys.serverPath(oldname), fsys.serverPath(newname))
+	})
+	if fsys.cache != nil {
+		fsys.cache.invalidateTree(fsys.serverPath(oldname))
+		fsys.cache.invalidateTree(fsys.serverPath(newname))
+	}
+	fsys.Invalidate(oldname)
+	fsys.Invalidate(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: errors.WithStack(mapErr(err))}
+	}
+	return nil
+}
+
+// Chtimes sets the modification time of the named file with MFMT.
+// atime is ignored, as FTP has no way to set it.
+// It fails with ErrUnsupported if the server does not advertise MFMT.
+func (fsys *FS) Chtimes(name string, atime, mtime time.Time) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: ErrReadOnly}
+	}
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		if !c.IsSetTimeSupported() {
+			return ErrUnsupported
+		}
+		return c.SetTime(fsys.serverPath(name), mtime)
+	})
+	fsys.Invalidate(name)
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	return nil
+}
+
+// Chmod sets the permission bits of the named file to those of mode with SITE CHMOD.
+// It fails with ErrUnsupported if the server does not implement it,
+// or if fsys was not opened by Dial, which alone can send commands that jlaffaye/ftp lacks.
+func (fsys *FS) Chmod(name string, mode fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "chmod", Path: name, Err: ErrReadOnly}
+	}
+	err := fsys.do(func(c *jlaftp.ServerConn) error {
+		_, _, err := fsys.command(c, jlaftp.StatusCommandOK, "SITE CHMOD %04o %s", mode.Perm(), fsys.serverPath(name))
+		return err
+	})
+	if err != nil {
+		return &fs.PathError{Op: "chmod", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	return nil
+}
+
+// Truncate changes the size of the named file.
+// Truncating to zero stores an empty file with STOR, which creates the file if it does not exist.
+// Growing a file appends zeros with APPE.
+// Shrinking it otherwise downloads the first size bytes to a temporary file and stores them back,
+// so that the file is briefly incomplete.
+func (fsys *FS) Truncate(name string, size int64) error {
+	if !fs.ValidPath(name) || name == "." || size < 0 {
+		return &fs.PathError{Op: "truncate", Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.opts.readOnly {
+		return &fs.PathError{Op: "truncate", Path: name, Err: ErrReadOnly}
+	}
+	// Sizes are those of binary mode.
+	fsys = fsys.ASCII(false)
+	var err error
+	if size == 0 {
+		err = fsys.store(name, func() (io.Reader, error) { return bytes.NewReader(nil), nil })
+	} else {
+		err = fsys.truncate(name, size)
+	}
+	fsys.Invalidate(name)
+	if err != nil {
+		return &fs.PathError{Op: "truncate", Path: name, Err: errors.WithStack(mapErr(err))}
+	}
+	return nil
+}
+
+func (fsys *FS) truncate(name string, size int64) error {
+	_, entry, err := fsys.resolve(name, 0)
+	if err != nil {
+		return err
+	}
+	if entry.Type != jlaftp.EntryTypeFile {
+		return errors.New("not a regular file")
+	}
+	info := fileinfo{e: *entry}
+	fsys.setSize(&info, name)
+	cur := info.Size()
+	if size == cur {
+		return nil
+	}
+	if size > cur {
+		return fsys.do(func(c *jlaftp.ServerConn) error {
+			if err := fsys.setType(c); err != nil {
+				return err
+			}
+			start := time.Now()
+			err := c.Append(fsys.serverPath(name), fsys.limitReader(io.LimitReader(zeros{}, size-cur)))
+			fsys.observeCommand("APPE", start, err)
+			return err
+		})
+	}
+
+	tmp, err := os.CreateTemp("", "ftp-truncate-*")
+	if err != nil {
+		return errors.Wrap(err, "")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	f, err := fsys.open(name, false)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tmp, f, size)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return fsys.store(name, func() (io.Reader, error) {
+		_, err := tmp.Seek(0, io.SeekStart)
+		return tmp, errors.Wrap(err, "")
+	})
+}
+
+// store uploads the reader from r to the named file with STOR.
+// r is called again for each attempt, see WithRetry.
+func (fsys *FS) store(name string, r func() (io.Reader, error)) error {
+	return fsys.do(func(c *jlaftp.ServerConn) error {
+		if err := fsys.setType(c); err != nil {
+			return err
+		}
+		body, err := r()
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = c.Stor(fsys.serverPath(name), fsys.limitReader(body))
+		fsys.observeCommand("STOR", start, err)
+		return err
+	})
+}
+
+// zeros reads an endless stream of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}